@@ -0,0 +1,89 @@
+package shopify
+
+import (
+	"context"
+	"strings"
+)
+
+// AccessScopes wraps AccessScopesWithContext using context.Background.
+func (client *Client) AccessScopes() ([]string, error) {
+	return client.AccessScopesWithContext(context.Background())
+}
+
+// Return access scopes granted to the app by the shop. The result is cached
+// until ResetAccessScopes is called.
+func (client *Client) AccessScopesWithContext(ctx context.Context) ([]string, error) {
+	client.scopesMu.Lock()
+	defer client.scopesMu.Unlock()
+	if client.scopes != nil {
+		return client.scopes, nil
+	}
+	scopes := []string{}
+	err := client.New(`query { currentAppInstallation { accessScopes { handle } } }`).
+		WithContext(ctx).Do(&scopes, "currentAppInstallation.accessScopes.*.handle")
+	if err != nil {
+		return nil, err
+	}
+	client.scopes = scopes
+	return scopes, nil
+}
+
+// ResetAccessScopes clears cached access scopes, for example after the
+// merchant re-authorizes the app.
+func (client *Client) ResetAccessScopes() {
+	client.scopesMu.Lock()
+	defer client.scopesMu.Unlock()
+	client.scopes = nil
+}
+
+// VerifyAccessScopes wraps VerifyAccessScopesWithContext using
+// context.Background.
+func (client *Client) VerifyAccessScopes(required ...string) (missing, extra []string, err error) {
+	return client.VerifyAccessScopesWithContext(context.Background(), required...)
+}
+
+// Compare granted access scopes with the required ones. Missing are required
+// scopes not granted, extra are granted scopes not required. A "write_"
+// scope implies the "read_" scope of the same resource.
+func (client *Client) VerifyAccessScopesWithContext(ctx context.Context, required ...string) (missing, extra []string, err error) {
+	granted, err := client.AccessScopesWithContext(ctx)
+	if err != nil {
+		return
+	}
+	missing, extra = compareScopes(granted, required)
+	return
+}
+
+func compareScopes(granted, required []string) (missing, extra []string) {
+	grantedSet := scopeSet(granted)
+	requiredSet := scopeSet(required)
+	for _, scope := range required {
+		if !grantedSet[scope] && !grantedSet[writeScope(scope)] {
+			missing = append(missing, scope)
+		}
+	}
+	for _, scope := range granted {
+		if !requiredSet[scope] && !requiredSet[writeScope(scope)] {
+			extra = append(extra, scope)
+		}
+	}
+	return
+}
+
+func scopeSet(scopes []string) map[string]bool {
+	set := map[string]bool{}
+	for _, scope := range scopes {
+		set[scope] = true
+	}
+	return set
+}
+
+// writeScope returns the write scope implying a read scope.
+func writeScope(scope string) string {
+	for _, prefix := range []string{"read_", "unauthenticated_read_"} {
+		if strings.HasPrefix(scope, prefix) {
+			return strings.Replace(scope, "read_", "write_", 1)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package shopify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestVerifyAccessScopes(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"data":{"currentAppInstallation":{"accessScopes":[
+{"handle":"write_products"},{"handle":"read_products"},{"handle":"read_orders"},{"handle":"read_themes"}]}}}`))
+	}))
+
+	missing, extra, err := c.VerifyAccessScopes("read_products", "write_products", "read_orders", "write_orders", "read_customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toJSON(missing) != `["write_orders","read_customers"]` {
+		t.Errorf("missing scopes are not correct: %v", missing)
+	}
+	if toJSON(extra) != `["read_themes"]` {
+		t.Errorf("extra scopes are not correct: %v", extra)
+	}
+
+	missing, extra, _ = c.VerifyAccessScopes("read_products", "read_orders", "read_themes")
+	if len(missing) != 0 || toJSON(extra) != `["write_products"]` {
+		t.Error("write scope should imply read scope")
+	}
+	if requests != 1 {
+		t.Error("access scopes should be cached")
+	}
+
+	c.ResetAccessScopes()
+	c.AccessScopes()
+	if requests != 2 {
+		t.Error("access scopes should be reloaded")
+	}
+}
@@ -0,0 +1,318 @@
+package shopify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrChargeNotFound = errors.New("charge not found")
+)
+
+const (
+	// Billing intervals of recurring charges.
+	Every30Days = "EVERY_30_DAYS"
+	Annual      = "ANNUAL"
+)
+
+type (
+	// Amount of money in a currency, like 10.00 USD. Amount is a decimal
+	// string, like "10.00", to keep its precision.
+	Money struct {
+		Amount       string `json:"amount"`
+		CurrencyCode string `json:"currencyCode"`
+	}
+
+	// A recurring charge (app subscription), optionally with usage pricing.
+	RecurringCharge struct {
+		Name      string
+		Price     Money
+		Interval  string // Every30Days (default) or Annual
+		TrialDays int
+		Test      bool
+		ReturnURL string // shop and charge_id are appended by Shopify
+
+		// Maximum amount of usage charges in a billing interval. If not
+		// nil, the subscription has a usage line item.
+		CappedAmount *Money
+		UsageTerms   string
+	}
+
+	// A one-time charge (app purchase).
+	OneTimeCharge struct {
+		Name      string
+		Price     Money
+		Test      bool
+		ReturnURL string
+	}
+
+	AppSubscription struct {
+		Id               string                    `json:"id"`
+		Name             string                    `json:"name"`
+		Status           string                    `json:"status"`
+		Test             bool                      `json:"test"`
+		TrialDays        int                       `json:"trialDays"`
+		CurrentPeriodEnd string                    `json:"currentPeriodEnd"`
+		LineItems        []AppSubscriptionLineItem `json:"lineItems"`
+	}
+
+	AppSubscriptionLineItem struct {
+		Id   string `json:"id"`
+		Plan struct {
+			PricingDetails struct {
+				Typename string `json:"__typename"`
+			} `json:"pricingDetails"`
+		} `json:"plan"`
+	}
+
+	// ClientFunc returns the client of the shop of a request.
+	ClientFunc func(r *http.Request) (*Client, error)
+)
+
+// CreateRecurringCharge wraps CreateRecurringChargeWithContext using
+// context.Background.
+func (client *Client) CreateRecurringCharge(charge RecurringCharge) (confirmationUrl, id string, err error) {
+	return client.CreateRecurringChargeWithContext(context.Background(), charge)
+}
+
+// Create an app subscription and return the url for the merchant to approve
+// the charge and the id of the subscription.
+func (client *Client) CreateRecurringChargeWithContext(ctx context.Context, charge RecurringCharge) (confirmationUrl, id string, err error) {
+	interval := charge.Interval
+	if interval == "" {
+		interval = Every30Days
+	}
+	lineItems := []KV{{
+		"plan": KV{
+			"appRecurringPricingDetails": KV{
+				"price":    charge.Price,
+				"interval": interval,
+			},
+		},
+	}}
+	if charge.CappedAmount != nil {
+		lineItems = append(lineItems, KV{
+			"plan": KV{
+				"appUsagePricingDetails": KV{
+					"cappedAmount": charge.CappedAmount,
+					"terms":        charge.UsageTerms,
+				},
+			},
+		})
+	}
+	err = client.New(`mutation ($name: String!, $lineItems: [AppSubscriptionLineItemInput!]!,
+$returnUrl: URL!, $trialDays: Int, $test: Boolean) {
+appSubscriptionCreate(name: $name, lineItems: $lineItems, returnUrl: $returnUrl,
+trialDays: $trialDays, test: $test) {
+  userErrors { field message }
+  confirmationUrl
+  appSubscription { id }
+} }`,
+		"name", charge.Name,
+		"lineItems", lineItems,
+		"returnUrl", charge.ReturnURL,
+		"trialDays", charge.TrialDays,
+		"test", charge.Test,
+	).WithContext(ctx).Do(
+		&confirmationUrl, "appSubscriptionCreate.confirmationUrl",
+		&id, "appSubscriptionCreate.appSubscription.id",
+	)
+	return
+}
+
+// CreateUsageCharge wraps CreateUsageChargeWithContext using
+// context.Background.
+func (client *Client) CreateUsageCharge(lineItemId, description string, price Money) (id string, err error) {
+	return client.CreateUsageChargeWithContext(context.Background(), lineItemId, description, price)
+}
+
+// Create a usage record on the usage line item of an active subscription
+// and return its id.
+func (client *Client) CreateUsageChargeWithContext(ctx context.Context, lineItemId, description string, price Money) (id string, err error) {
+	err = client.New(`mutation ($lineItemId: ID!, $description: String!, $price: MoneyInput!) {
+appUsageRecordCreate(subscriptionLineItemId: $lineItemId, description: $description, price: $price) {
+  userErrors { field message }
+  appUsageRecord { id }
+} }`,
+		"lineItemId", lineItemId,
+		"description", description,
+		"price", price,
+	).WithContext(ctx).Do(&id, "appUsageRecordCreate.appUsageRecord.id")
+	return
+}
+
+// CreateOneTimeCharge wraps CreateOneTimeChargeWithContext using
+// context.Background.
+func (client *Client) CreateOneTimeCharge(charge OneTimeCharge) (confirmationUrl, id string, err error) {
+	return client.CreateOneTimeChargeWithContext(context.Background(), charge)
+}
+
+// Create an app purchase and return the url for the merchant to approve the
+// charge and the id of the purchase.
+func (client *Client) CreateOneTimeChargeWithContext(ctx context.Context, charge OneTimeCharge) (confirmationUrl, id string, err error) {
+	err = client.New(`mutation ($name: String!, $price: MoneyInput!, $returnUrl: URL!, $test: Boolean) {
+appPurchaseOneTimeCreate(name: $name, price: $price, returnUrl: $returnUrl, test: $test) {
+  userErrors { field message }
+  confirmationUrl
+  appPurchaseOneTime { id }
+} }`,
+		"name", charge.Name,
+		"price", charge.Price,
+		"returnUrl", charge.ReturnURL,
+		"test", charge.Test,
+	).WithContext(ctx).Do(
+		&confirmationUrl, "appPurchaseOneTimeCreate.confirmationUrl",
+		&id, "appPurchaseOneTimeCreate.appPurchaseOneTime.id",
+	)
+	return
+}
+
+// ActiveSubscriptions wraps ActiveSubscriptionsWithContext using
+// context.Background.
+func (client *Client) ActiveSubscriptions() ([]AppSubscription, error) {
+	return client.ActiveSubscriptionsWithContext(context.Background())
+}
+
+// Return active subscriptions of the app on the shop.
+func (client *Client) ActiveSubscriptionsWithContext(ctx context.Context) (subscriptions []AppSubscription, err error) {
+	err = client.New(`query { currentAppInstallation { activeSubscriptions {
+id name status test trialDays currentPeriodEnd
+lineItems { id plan { pricingDetails { __typename } } }
+} } }`).WithContext(ctx).Do(&subscriptions, "currentAppInstallation.activeSubscriptions.*")
+	return
+}
+
+// ChargeStatus wraps ChargeStatusWithContext using context.Background.
+func (client *Client) ChargeStatus(chargeId string) (string, error) {
+	return client.ChargeStatusWithContext(context.Background(), chargeId)
+}
+
+// Return status of a subscription or one-time charge, such as ACTIVE,
+// DECLINED or PENDING. The charge id can be a global id or the numeric
+// charge_id appended to the return url. ErrChargeNotFound is returned if
+// there is no such charge.
+func (client *Client) ChargeStatusWithContext(ctx context.Context, chargeId string) (status string, err error) {
+	ids := []string{chargeId}
+	if _, e := strconv.ParseInt(chargeId, 10, 64); e == nil {
+		ids = []string{
+			"gid://shopify/AppSubscription/" + chargeId,
+			"gid://shopify/AppPurchaseOneTime/" + chargeId,
+		}
+	}
+	var statuses []*string
+	err = client.New(`query ($ids: [ID!]!) { nodes(ids: $ids) {
+... on AppSubscription { status }
+... on AppPurchaseOneTime { status }
+} }`, "ids", ids).WithContext(ctx).Do(&statuses, "nodes.*.status")
+	if err != nil {
+		return
+	}
+	for _, s := range statuses {
+		if s != nil && *s != "" {
+			return *s, nil
+		}
+	}
+	err = ErrChargeNotFound
+	return
+}
+
+// UsageLineItemId returns the id of the usage line item, or an empty string
+// if the subscription has no usage pricing.
+func (s AppSubscription) UsageLineItemId() string {
+	for _, item := range s.LineItems {
+		if item.Plan.PricingDetails.Typename == "AppUsagePricing" {
+			return item.Id
+		}
+	}
+	return ""
+}
+
+// BillingReturnHandler returns a handler for the return url of charges. It
+// checks the status of the charge in the "charge_id" query param and calls
+// onReturn with it.
+func BillingReturnHandler(clientFunc ClientFunc, onReturn func(w http.ResponseWriter, r *http.Request, status string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chargeId := r.URL.Query().Get("charge_id")
+		if chargeId == "" {
+			http.Error(w, "missing charge_id", http.StatusBadRequest)
+			return
+		}
+		client, err := clientFunc(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		status, err := client.ChargeStatusWithContext(r.Context(), chargeId)
+		if err == ErrChargeNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		onReturn(w, r, status)
+	})
+}
+
+// RequireActiveSubscription returns a middleware which calls next only if
+// the shop has an active subscription, otherwise onInactive is called, for
+// example to redirect to a plan selection page. Subscriptions are queried on
+// every request, which adds a GraphQL request to every page view and uses
+// the query cost of the shop. Use RequireActiveSubscriptionWithCache to
+// query less often.
+func RequireActiveSubscription(clientFunc ClientFunc, onInactive http.Handler) func(next http.Handler) http.Handler {
+	return RequireActiveSubscriptionWithCache(clientFunc, onInactive, 0)
+}
+
+// RequireActiveSubscriptionWithCache is like RequireActiveSubscription, but
+// shops with an active subscription are remembered for ttl. A cancelled
+// subscription may still pass until ttl is over. Shops without one are
+// queried on every request, so they pass as soon as a charge is approved.
+func RequireActiveSubscriptionWithCache(clientFunc ClientFunc, onInactive http.Handler, ttl time.Duration) func(next http.Handler) http.Handler {
+	var mu sync.Mutex
+	activeUntil := map[string]time.Time{} // shop => expiry
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, err := clientFunc(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			now := time.Now()
+			mu.Lock()
+			active := now.Before(activeUntil[client.Shop])
+			mu.Unlock()
+			if active {
+				next.ServeHTTP(w, r)
+				return
+			}
+			subscriptions, err := client.ActiveSubscriptionsWithContext(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			for _, s := range subscriptions {
+				if s.Status == "ACTIVE" {
+					if ttl > 0 {
+						mu.Lock()
+						for shop, until := range activeUntil {
+							if now.After(until) {
+								delete(activeUntil, shop)
+							}
+						}
+						activeUntil[client.Shop] = now.Add(ttl)
+						mu.Unlock()
+					}
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			onInactive.ServeHTTP(w, r)
+		})
+	}
+}
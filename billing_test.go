@@ -0,0 +1,128 @@
+package shopify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBillingTestClient(t *testing.T, active bool) *Client {
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "appSubscriptionCreate"):
+			lineItems := req.Variables["lineItems"].([]interface{})
+			if req.Variables["name"] != "Pro" || len(lineItems) != 2 {
+				w.Write([]byte(`{"data":{"appSubscriptionCreate":{"userErrors":[{"field":["name"],"message":"wrong input"}]}}}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"appSubscriptionCreate":{"userErrors":[],
+"confirmationUrl":"https://demo.myshopify.com/admin/charges/1/confirm","appSubscription":{"id":"gid://shopify/AppSubscription/1"}}}}`))
+		case strings.Contains(req.Query, "activeSubscriptions"):
+			if !active {
+				w.Write([]byte(`{"data":{"currentAppInstallation":{"activeSubscriptions":[]}}}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"currentAppInstallation":{"activeSubscriptions":[{"id":"gid://shopify/AppSubscription/1",
+"name":"Pro","status":"ACTIVE","lineItems":[{"id":"gid://shopify/AppSubscriptionLineItem/1","plan":{"pricingDetails":{"__typename":"AppRecurringPricing"}}},
+{"id":"gid://shopify/AppSubscriptionLineItem/2","plan":{"pricingDetails":{"__typename":"AppUsagePricing"}}}]}]}}}`))
+		case strings.Contains(req.Query, "nodes"):
+			if req.Variables["ids"].([]interface{})[0] == "gid://shopify/AppSubscription/404" {
+				w.Write([]byte(`{"data":{"nodes":[null,null]}}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"nodes":[null,{"status":"ACTIVE"}]}}`))
+		}
+	}))
+}
+
+func TestBilling(t *testing.T) {
+	c := newBillingTestClient(t, true)
+	url, id, err := c.CreateRecurringCharge(RecurringCharge{
+		Name:         "Pro",
+		Price:        Money{"9.99", "USD"},
+		ReturnURL:    "https://app.example.com/billing?shop=demo",
+		CappedAmount: &Money{"100.00", "USD"},
+		UsageTerms:   "$1 per order",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://demo.myshopify.com/admin/charges/1/confirm" || id != "gid://shopify/AppSubscription/1" {
+		t.Error("confirmation url or id is not correct")
+	}
+	if _, _, err := c.CreateRecurringCharge(RecurringCharge{Name: "Basic"}); err == nil || err.Error() != "wrong input" {
+		t.Error("user errors should be returned")
+	}
+
+	subscriptions, err := c.ActiveSubscriptions()
+	if err != nil || len(subscriptions) != 1 || subscriptions[0].UsageLineItemId() != "gid://shopify/AppSubscriptionLineItem/2" {
+		t.Error("active subscriptions are not correct")
+	}
+
+	var status string
+	h := BillingReturnHandler(func(r *http.Request) (*Client, error) {
+		return c, nil
+	}, func(w http.ResponseWriter, r *http.Request, s string) {
+		status = s
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/billing?shop=demo&charge_id=1", nil))
+	if w.Code != http.StatusOK || status != "ACTIVE" {
+		t.Error("status of the charge should be ACTIVE")
+	}
+	status = ""
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/billing?shop=demo&charge_id=404", nil))
+	if w.Code != http.StatusNotFound || status != "" {
+		t.Error("unknown charge should not be found")
+	}
+	if _, err := c.ChargeStatus("404"); err != ErrChargeNotFound {
+		t.Error("unknown charge should return error:", err)
+	}
+}
+
+func TestRequireActiveSubscription(t *testing.T) {
+	for _, active := range []bool{true, false} {
+		c := newBillingTestClient(t, active)
+		m := RequireActiveSubscription(func(r *http.Request) (*Client, error) {
+			return c, nil
+		}, http.RedirectHandler("/plans", http.StatusFound))
+		w := httptest.NewRecorder()
+		m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if active && w.Code != http.StatusNoContent {
+			t.Error("shop with active subscription should pass")
+		}
+		if !active && w.Code != http.StatusFound {
+			t.Error("shop without active subscription should be redirected")
+		}
+	}
+
+	var requests int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"data":{"currentAppInstallation":{"activeSubscriptions":[{"status":"ACTIVE"}]}}}`))
+	}))
+	m := RequireActiveSubscriptionWithCache(func(r *http.Request) (*Client, error) {
+		return c, nil
+	}, http.RedirectHandler("/plans", http.StatusFound), time.Minute)
+	h := m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusNoContent {
+			t.Error("shop with active subscription should pass")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("active subscription should be cached, got %d requests", requests)
+	}
+}
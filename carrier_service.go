@@ -0,0 +1,257 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Shopify waits at most 10 seconds for the rates, leave some time for the
+// network.
+const defaultCarrierServiceTimeout = 8 * time.Second
+
+type (
+	// Carrier service to provide shipping rates at checkout.
+	CarrierService struct {
+		Id                 int64  `json:"id,omitempty"`
+		Name               string `json:"name"`
+		CallbackURL        string `json:"callback_url"`
+		ServiceDiscovery   bool   `json:"service_discovery"`
+		Active             bool   `json:"active"`
+		Format             string `json:"format,omitempty"`
+		CarrierServiceType string `json:"carrier_service_type,omitempty"`
+	}
+
+	// Shipping rate request sent to the callback url of a carrier service.
+	RateRequest struct {
+		Origin      RateAddress `json:"origin"`
+		Destination RateAddress `json:"destination"`
+		Items       []RateItem  `json:"items"`
+		Currency    string      `json:"currency"`
+		Locale      string      `json:"locale"`
+	}
+
+	RateAddress struct {
+		Country     string   `json:"country"`
+		PostalCode  string   `json:"postal_code"`
+		Province    string   `json:"province"`
+		City        string   `json:"city"`
+		Name        string   `json:"name"`
+		Address1    string   `json:"address1"`
+		Address2    string   `json:"address2"`
+		Address3    string   `json:"address3"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+		Phone       string   `json:"phone"`
+		Fax         string   `json:"fax"`
+		Email       string   `json:"email"`
+		AddressType string   `json:"address_type"`
+		CompanyName string   `json:"company_name"`
+	}
+
+	RateItem struct {
+		Name               string            `json:"name"`
+		Sku                string            `json:"sku"`
+		Quantity           int               `json:"quantity"`
+		Grams              int               `json:"grams"`
+		Price              int64             `json:"price"` // in cents
+		Vendor             string            `json:"vendor"`
+		RequiresShipping   bool              `json:"requires_shipping"`
+		Taxable            bool              `json:"taxable"`
+		FulfillmentService string            `json:"fulfillment_service"`
+		Properties         map[string]string `json:"properties"`
+		ProductId          int64             `json:"product_id"`
+		VariantId          int64             `json:"variant_id"`
+	}
+
+	// Shipping rate returned to Shopify.
+	ShippingRate struct {
+		ServiceName     string `json:"service_name"`
+		ServiceCode     string `json:"service_code"`
+		TotalPrice      int64  `json:"total_price,string"` // in cents
+		Description     string `json:"description,omitempty"`
+		Currency        string `json:"currency"`
+		MinDeliveryDate string `json:"min_delivery_date,omitempty"`
+		MaxDeliveryDate string `json:"max_delivery_date,omitempty"`
+	}
+
+	// RateProvider calculates shipping rates of a rate request.
+	RateProvider interface {
+		Rates(ctx context.Context, shop string, req *RateRequest) ([]ShippingRate, error)
+	}
+
+	// RateProviderFunc is a function implementing RateProvider.
+	RateProviderFunc func(ctx context.Context, shop string, req *RateRequest) ([]ShippingRate, error)
+
+	// CarrierServiceHandler serves the callback url of a carrier service.
+	CarrierServiceHandler struct {
+		// API secret key of the app, used to verify requests. Requests are
+		// rejected if it is empty.
+		ClientSecret string
+
+		Provider RateProvider
+
+		// Deadline of the provider, defaults to 8 seconds, under Shopify's
+		// timeout of 10 seconds.
+		Timeout time.Duration
+	}
+
+	rateRequestBody struct {
+		Rate *RateRequest `json:"rate"`
+	}
+
+	rateResponseBody struct {
+		Rates []ShippingRate `json:"rates"`
+	}
+
+	carrierServiceBody struct {
+		CarrierService *CarrierService `json:"carrier_service"`
+	}
+)
+
+func (f RateProviderFunc) Rates(ctx context.Context, shop string, req *RateRequest) ([]ShippingRate, error) {
+	return f(ctx, shop, req)
+}
+
+// ServeHTTP decodes the rate request, calls the provider and writes the
+// rates. If the provider fails or misses the deadline, an error status is
+// written so that Shopify can use backup rates.
+func (h *CarrierServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := VerifyWebhook(r, h.ClientSecret); err != nil {
+		writeVerifyError(w, err)
+		return
+	}
+	shop, err := ShopFromDomain(r.Header.Get("X-Shopify-Shop-Domain"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := rateRequestBody{Rate: new(RateRequest)}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Rate == nil {
+		http.Error(w, "invalid rate request", http.StatusBadRequest)
+		return
+	}
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultCarrierServiceTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	type result struct {
+		rates []ShippingRate
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rates, err := h.Provider.Rates(ctx, shop, body.Rate)
+		done <- result{rates, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	if res.err == context.DeadlineExceeded {
+		http.Error(w, res.err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	if res.err != nil {
+		http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if res.rates == nil {
+		res.rates = []ShippingRate{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rateResponseBody{res.rates})
+}
+
+// CarrierServices wraps CarrierServicesWithContext using context.Background.
+func (client *Client) CarrierServices() ([]CarrierService, error) {
+	return client.CarrierServicesWithContext(context.Background())
+}
+
+// Return carrier services of the shop.
+func (client *Client) CarrierServicesWithContext(ctx context.Context) (services []CarrierService, err error) {
+	err = client.NewRest("GET", "carrier_services").WithContext(ctx).
+		Do(&services, "carrier_services.*")
+	return
+}
+
+// CreateCarrierService wraps CreateCarrierServiceWithContext using
+// context.Background.
+func (client *Client) CreateCarrierService(service CarrierService) (*CarrierService, error) {
+	return client.CreateCarrierServiceWithContext(context.Background(), service)
+}
+
+// Create a carrier service with JSON format and return it with its id.
+func (client *Client) CreateCarrierServiceWithContext(ctx context.Context, service CarrierService) (*CarrierService, error) {
+	service.Id = 0
+	if service.Format == "" {
+		service.Format = "json"
+	}
+	created := new(CarrierService)
+	err := client.NewRest("POST", "carrier_services", nil, carrierServiceBody{&service}).
+		WithContext(ctx).Do(created, "carrier_service")
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateCarrierService wraps UpdateCarrierServiceWithContext using
+// context.Background.
+func (client *Client) UpdateCarrierService(service CarrierService) (*CarrierService, error) {
+	return client.UpdateCarrierServiceWithContext(context.Background(), service)
+}
+
+// Update the carrier service of the id.
+func (client *Client) UpdateCarrierServiceWithContext(ctx context.Context, service CarrierService) (*CarrierService, error) {
+	updated := new(CarrierService)
+	err := client.NewRest("PUT", fmt.Sprintf("carrier_services/%d", service.Id), nil, carrierServiceBody{&service}).
+		WithContext(ctx).Do(updated, "carrier_service")
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteCarrierService wraps DeleteCarrierServiceWithContext using
+// context.Background.
+func (client *Client) DeleteCarrierService(id int64) error {
+	return client.DeleteCarrierServiceWithContext(context.Background(), id)
+}
+
+// Delete the carrier service of the id.
+func (client *Client) DeleteCarrierServiceWithContext(ctx context.Context, id int64) error {
+	return client.NewRest("DELETE", fmt.Sprintf("carrier_services/%d", id)).WithContext(ctx).Do()
+}
+
+// RegisterCarrierService wraps RegisterCarrierServiceWithContext using
+// context.Background.
+func (client *Client) RegisterCarrierService(service CarrierService) (*CarrierService, error) {
+	return client.RegisterCarrierServiceWithContext(context.Background(), service)
+}
+
+// Update the carrier service of the same name, or create one if it does not
+// exist.
+func (client *Client) RegisterCarrierServiceWithContext(ctx context.Context, service CarrierService) (*CarrierService, error) {
+	services, err := client.CarrierServicesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		if s.Name == service.Name {
+			service.Id = s.Id
+			return client.UpdateCarrierServiceWithContext(ctx, service)
+		}
+	}
+	return client.CreateCarrierServiceWithContext(ctx, service)
+}
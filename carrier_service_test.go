@@ -0,0 +1,129 @@
+package shopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRateRequest = `{"rate":{"origin":{"country":"CA","postal_code":"K2P1L4","province":"ON","city":"Ottawa"},
+"destination":{"country":"CA","postal_code":"K1M1M4","province":"ON","city":"Ottawa","latitude":45.4,"longitude":-75.7},
+"items":[{"name":"Short Sleeve T-Shirt","sku":"","quantity":1,"grams":1000,"price":1999,"vendor":"Jamie D's Emporium",
+"requires_shipping":true,"taxable":true,"fulfillment_service":"manual","properties":null,"product_id":48447225880,"variant_id":258644705304}],
+"currency":"USD","locale":"en"}}`
+
+func newSignedRequest(method, target, body string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(body))
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	r.Header.Set("X-Shopify-Shop-Domain", "demo.myshopify.com")
+	return r
+}
+
+func TestCarrierServiceHandler(t *testing.T) {
+	h := &CarrierServiceHandler{
+		ClientSecret: testSecret,
+		Timeout:      50 * time.Millisecond,
+		Provider: RateProviderFunc(func(ctx context.Context, shop string, req *RateRequest) ([]ShippingRate, error) {
+			if shop != "demo" || len(req.Items) != 1 || req.Items[0].Price != 1999 {
+				return nil, errors.New("wrong request")
+			}
+			if req.Destination.City == "Slow" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return []ShippingRate{{
+				ServiceName: "Express",
+				ServiceCode: "EXP",
+				TotalPrice:  1295,
+				Currency:    req.Currency,
+			}}, nil
+		}),
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/rates", testRateRequest))
+	if w.Code != http.StatusOK {
+		t.Fatalf("request failed: %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Rates []map[string]interface{} `json:"rates"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Rates) != 1 || body.Rates[0]["total_price"] != "1295" || body.Rates[0]["service_code"] != "EXP" {
+		t.Errorf("rates are not correct: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/rates", strings.Replace(testRateRequest, `"K1M1M4","province":"ON","city":"Ottawa"`, `"K1M1M4","province":"ON","city":"Slow"`, 1)))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("slow provider should time out, got %d", w.Code)
+	}
+
+	r := newSignedRequest("POST", "/rates", testRateRequest)
+	r.Header.Set("X-Shopify-Hmac-Sha256", "invalid")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("unsigned request should be rejected")
+	}
+
+	r = newSignedRequest("POST", "/rates", testRateRequest)
+	r.Header.Set("X-Shopify-Shop-Domain", "evil.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("request of invalid shop should be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/rates", strings.Repeat(" ", maxWebhookBodySize+1)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Error("request with large body should be rejected")
+	}
+
+	h.ClientSecret = ""
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/rates", testRateRequest))
+	if w.Code != http.StatusInternalServerError {
+		t.Error("request should be rejected without client secret")
+	}
+}
+
+func TestRegisterCarrierService(t *testing.T) {
+	var created, updated bool
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /admin/api/2021-10/carrier_services.json":
+			if created {
+				w.Write([]byte(`{"carrier_services":[{"id":1,"name":"Rates","callback_url":"https://app.example.com/rates"}]}`))
+			} else {
+				w.Write([]byte(`{"carrier_services":[]}`))
+			}
+		case "POST /admin/api/2021-10/carrier_services.json":
+			created = true
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"carrier_service":{"id":1,"name":"Rates","callback_url":"https://app.example.com/rates","format":"json"}}`))
+		case "PUT /admin/api/2021-10/carrier_services/1.json":
+			updated = true
+			w.Write([]byte(`{"carrier_service":{"id":1,"name":"Rates","callback_url":"https://app.example.com/rates2"}}`))
+		}
+	}))
+	service, err := c.RegisterCarrierService(CarrierService{Name: "Rates", CallbackURL: "https://app.example.com/rates"})
+	if err != nil || !created || service.Id != 1 || service.Format != "json" {
+		t.Fatalf("carrier service should be created: %v", err)
+	}
+	service, err = c.RegisterCarrierService(CarrierService{Name: "Rates", CallbackURL: "https://app.example.com/rates2"})
+	if err != nil || !updated || service.CallbackURL != "https://app.example.com/rates2" {
+		t.Errorf("carrier service should be updated: %v", err)
+	}
+}
@@ -11,8 +11,16 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/shopify/graphql"
 )
 
+// DefaultAPIVersion is the Admin API version used by clients without
+// APIVersion.
+const DefaultAPIVersion = "2021-10"
+
 var (
 	ErrUnauthorized = errors.New("401 Unauthorized: incorrect authentication credential")
 )
@@ -20,16 +28,32 @@ var (
 type (
 	Client struct {
 		Debug      bool   // print request and response body if true
-		Shop       string // shop name
+		Validate   bool   // parse and validate queries before sending if true
+		Minify     bool   // remove whitespace and comments from queries if true
+		Shop       string // shop name, see NormalizeShop
+		APIVersion string // like "2021-10", DefaultAPIVersion if empty
+
+		// Validate queries against the schema before sending if not nil.
+		// Deprecated fields are allowed. See Client.Introspect.
+		Schema     *graphql.Schema
 		httpClient *http.Client
+
+		scopesMu sync.Mutex
+		scopes   []string // cached access scopes
+
+		throttleMu       sync.Mutex
+		throttle         ThrottleStatus // from the last GraphQL response
+		throttleAt       time.Time
+		throttleReserved float64 // cost reserved by requests not finished
 	}
 
 	Request struct {
 		Query     string                 `json:"query"`
 		Variables map[string]interface{} `json:"variables,omitempty"`
 
-		client *Client
-		ctx    context.Context
+		client   *Client
+		ctx      context.Context
+		reserved float64 // query cost reserved by waitThrottle
 	}
 
 	Errors []Error
@@ -53,8 +77,11 @@ type (
 	}
 
 	gqlResponse struct {
-		Data   *json.RawMessage `json:"data"`
-		Errors Errors           `json:"errors"`
+		Data       *json.RawMessage `json:"data"`
+		Errors     Errors           `json:"errors"`
+		Extensions struct {
+			Cost *QueryCost `json:"cost"`
+		} `json:"extensions"`
 	}
 
 	gqlResponseUserErrors struct {
@@ -62,11 +89,16 @@ type (
 	}
 )
 
-// Create a new client with shop name and http client.
+// Create a new client with shop name and http client. The shop is normalized
+// with NormalizeShop. If it is invalid, requests of the client return
+// ErrInvalidShop.
 func NewClient(shop string, httpClient *http.Client) *Client {
 	if t, ok := httpClient.Transport.(*Oauth2Transport); ok {
 		httpClient.Transport = &transport{t}
 	}
+	if name, err := NormalizeShop(shop); err == nil {
+		shop = name
+	}
 	return &Client{
 		Shop:       shop,
 		httpClient: httpClient,
@@ -102,6 +134,13 @@ func (req *Request) WithContext(ctx context.Context) *Request {
 	return req
 }
 
+// OperationName returns the name of the first operation of the query, or an
+// empty string if it is anonymous. An error is returned if the query can not
+// be parsed.
+func (req *Request) OperationName() (string, error) {
+	return graphql.OperationName(req.Query)
+}
+
 // MustDo is like Do but panics if operation fails.
 func (req *Request) MustDo(dest ...interface{}) {
 	if err := req.Do(dest...); err != nil {
@@ -113,47 +152,7 @@ func (req *Request) MustDo(dest ...interface{}) {
 // optional dest. Specify JSON path after each dest to efficiently get required
 // info from deep nested structs.
 func (req *Request) Do(dest ...interface{}) error {
-	url := fmt.Sprintf("https://%s.myshopify.com/admin/api/2021-10/graphql.json", req.client.Shop)
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
-	var ctx context.Context
-	if req.ctx == nil {
-		ctx = context.Background()
-	} else {
-		ctx = req.ctx
-	}
-	if req.client.Debug {
-		log.Println("[GQLReqURL] ", url)
-		log.Println("[GQLReqBody]", string(data))
-	}
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-	httpReq.Header.Add("Content-Type", "application/json")
-	res, err := req.client.httpClient.Do(httpReq)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-	if req.client.Debug {
-		log.Println("[GQLResBody]", string(b))
-	}
-	if res.StatusCode == 401 {
-		return ErrUnauthorized
-	}
-	if res.StatusCode != 200 {
-		return fmt.Errorf("response status is not ok: %d", res.StatusCode)
-	}
-
-	var resp gqlResponse
-	err = json.Unmarshal(b, &resp)
+	b, resp, err := req.exec()
 	if err != nil {
 		return err
 	}
@@ -190,6 +189,89 @@ func (req *Request) Do(dest ...interface{}) error {
 	return json.Unmarshal(*resp.Data, dest[0])
 }
 
+// exec sends the request and returns the response body and its decoded
+// data. GraphQL errors are returned in resp instead of err.
+func (req *Request) exec() (b []byte, resp gqlResponse, err error) {
+	defer func() {
+		req.client.updateThrottle(resp.Extensions.Cost, req.reserved)
+	}()
+	url, err := req.client.apiURL("graphql")
+	if err != nil {
+		return
+	}
+	body := *req
+	if req.client.Validate || req.client.Schema != nil {
+		var doc *graphql.Document
+		if doc, err = graphql.ParseAndValidate(body.Query); err != nil {
+			return
+		}
+		if req.client.Schema != nil {
+			if err = req.client.Schema.Validate(doc); err != nil {
+				return
+			}
+		}
+	}
+	if req.client.Minify {
+		if body.Query, err = graphql.Minify(body.Query); err != nil {
+			return
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	var ctx context.Context
+	if req.ctx == nil {
+		ctx = context.Background()
+	} else {
+		ctx = req.ctx
+	}
+	if req.client.Debug {
+		log.Println("[GQLReqURL] ", url)
+		log.Println("[GQLReqBody]", string(data))
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return
+	}
+	httpReq.Header.Add("Content-Type", "application/json")
+	res, err := req.client.httpClient.Do(httpReq)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	b, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	if req.client.Debug {
+		log.Println("[GQLResBody]", string(b))
+	}
+	if res.StatusCode == 401 {
+		err = ErrUnauthorized
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("response status is not ok: %d", res.StatusCode)
+		return
+	}
+	err = json.Unmarshal(b, &resp)
+	return
+}
+
+// apiURL returns the url of an Admin API endpoint of the shop.
+func (client *Client) apiURL(route string) (string, error) {
+	shop, err := NormalizeShop(client.Shop)
+	if err != nil {
+		return "", err
+	}
+	version := client.APIVersion
+	if version == "" {
+		version = DefaultAPIVersion
+	}
+	return fmt.Sprintf("https://%s.myshopify.com/admin/api/%s/%s.json", shop, version, route), nil
+}
+
 // Turn any slice into slice of interface.
 func Slice(slice interface{}) (out []interface{}) {
 	rv := reflect.ValueOf(slice)
@@ -216,6 +298,12 @@ func RemoveZeroValues(slice interface{}) (out []interface{}) {
 }
 
 func arrange(data []byte, target interface{}, key string) {
+	if e, ok := target.(*mapEntry); ok {
+		v := reflect.New(e.m.Type().Elem())
+		arrange(data, v.Interface(), key)
+		e.m.SetMapIndex(e.key, v.Elem())
+		return
+	}
 	keys := strings.Split(key, ".")
 	baseType := reflect.TypeOf(target).Elem()
 	if baseType.Kind() == reflect.Slice {
@@ -271,6 +359,16 @@ func (errs Errors) Error() string {
 	return strings.Join(msgs, ", ")
 }
 
+// firstPath returns the first element of the path, which is the alias or
+// name of the top-level field of the error.
+func (err Error) firstPath() string {
+	if len(err.Path) == 0 {
+		return ""
+	}
+	s, _ := err.Path[0].(string)
+	return s
+}
+
 func (errs UserErrors) Error() string {
 	var msgs []string
 	for _, err := range errs {
@@ -0,0 +1,311 @@
+package shopify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolRateLimit   = 2
+	defaultPoolBurst       = 40
+	defaultPoolIdleTimeout = 10 * time.Minute
+)
+
+var (
+	ErrStoreNotListable = errors.New("token store can not list shops")
+)
+
+type (
+	// ShopLister is implemented by token stores that can list shops with an
+	// offline token.
+	ShopLister interface {
+		Shops(ctx context.Context) ([]string, error)
+	}
+
+	// ClientPool lazily creates and caches clients of many shops with their
+	// offline tokens in the store. All clients share one transport, and
+	// requests of each shop are rate limited.
+	ClientPool struct {
+		Store TokenStore
+
+		// Used to refresh expiring offline tokens, can be nil.
+		Config *Oauth2Config
+
+		// Context of refreshing tokens and saving them to the store, which
+		// lives as long as the cached clients. Defaults to
+		// context.Background().
+		RefreshContext context.Context
+
+		// Shared transport of all clients. If nil, a clone of
+		// http.DefaultTransport is used.
+		Transport http.RoundTripper
+
+		// Requests per second of each shop and the maximum burst. If 0,
+		// they default to 2 and 40, the rate limit of the REST Admin API.
+		// Set RateLimit to a negative number to disable rate limiting.
+		RateLimit float64
+		Burst     int
+
+		// Clients not used for this long are evicted. If 0, it defaults to
+		// 10 minutes. Set it to a negative number to disable eviction.
+		IdleTimeout time.Duration
+
+		mu        sync.Mutex
+		clients   map[string]*pooledClient
+		transport http.RoundTripper
+		lastEvict time.Time
+	}
+
+	// Errors of shops in ClientPool.Each.
+	ShopErrors map[string]error
+
+	pooledClient struct {
+		client   *Client
+		lastUsed time.Time
+	}
+
+	rateLimiter struct {
+		mu     sync.Mutex
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+
+	rateLimitedTransport struct {
+		limiter *rateLimiter
+		base    http.RoundTripper
+	}
+)
+
+// NewClientPool creates a pool of clients of shops in the store.
+func NewClientPool(store TokenStore) *ClientPool {
+	return &ClientPool{Store: store}
+}
+
+// Get returns the cached client of a shop, or creates one with the offline
+// token of the shop in the store. ctx is only used to load the token.
+func (p *ClientPool) Get(ctx context.Context, shop string) (*Client, error) {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return nil, err
+	}
+	if client := p.cached(shop); client != nil {
+		return client, nil
+	}
+	refreshCtx := p.RefreshContext
+	if refreshCtx == nil {
+		refreshCtx = context.Background()
+	}
+	src, err := loadTokenSource(ctx, refreshCtx, p.Store, shop, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if pc := p.clients[shop]; pc != nil { // loaded by another call
+		pc.lastUsed = now
+		return pc.client, nil
+	}
+	var base http.RoundTripper = p.sharedTransport()
+	if rate, burst := p.rateLimit(); rate > 0 {
+		base = &rateLimitedTransport{newRateLimiter(rate, burst), base}
+	}
+	client := NewClient(shop, &http.Client{
+		Transport: &Oauth2Transport{Source: src, Base: base},
+	})
+	if p.clients == nil {
+		p.clients = map[string]*pooledClient{}
+	}
+	p.clients[shop] = &pooledClient{client, now}
+	return client, nil
+}
+
+func (p *ClientPool) cached(shop string) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.evictIdle(now)
+	if pc := p.clients[shop]; pc != nil {
+		pc.lastUsed = now
+		return pc.client
+	}
+	return nil
+}
+
+// Remove removes the client of a shop from the pool, for example after the
+// app is uninstalled.
+func (p *ClientPool) Remove(shop string) {
+	shop, _ = NormalizeShop(shop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, shop)
+}
+
+// Len returns number of cached clients.
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// EvictIdle removes clients which are not used within IdleTimeout. It is
+// also called by Get periodically.
+func (p *ClientPool) EvictIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastEvict = time.Time{}
+	p.evictIdle(time.Now())
+}
+
+// Each calls fn with the client of every shop listed by the store, running
+// at most concurrency calls at the same time. It stops starting new calls
+// once ctx is done. Failed shops are returned as ShopErrors.
+func (p *ClientPool) Each(ctx context.Context, concurrency int, fn func(ctx context.Context, client *Client) error) error {
+	lister, ok := p.Store.(ShopLister)
+	if !ok {
+		return ErrStoreNotListable
+	}
+	shops, err := lister.Shops(ctx)
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	errs := ShopErrors{}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, shop := range shops {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(shop string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			client, err := p.Get(ctx, shop)
+			if err == nil {
+				err = fn(ctx, client)
+			}
+			if err != nil {
+				mu.Lock()
+				errs[shop] = err
+				mu.Unlock()
+			}
+		}(shop)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *ClientPool) sharedTransport() http.RoundTripper {
+	if p.Transport != nil {
+		return p.Transport
+	}
+	if p.transport == nil {
+		p.transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return p.transport
+}
+
+// rateLimit returns the rate limit and burst with defaults applied.
+func (p *ClientPool) rateLimit() (rate float64, burst int) {
+	rate, burst = p.RateLimit, p.Burst
+	if rate == 0 {
+		rate = defaultPoolRateLimit
+	}
+	if burst == 0 {
+		burst = defaultPoolBurst
+	}
+	return
+}
+
+func (p *ClientPool) evictIdle(now time.Time) {
+	timeout := p.IdleTimeout
+	if timeout == 0 {
+		timeout = defaultPoolIdleTimeout
+	}
+	if timeout < 0 || now.Sub(p.lastEvict) < timeout/2 {
+		return
+	}
+	p.lastEvict = now
+	for shop, pc := range p.clients {
+		if now.Sub(pc.lastUsed) >= timeout {
+			delete(p.clients, shop)
+		}
+	}
+}
+
+func (errs ShopErrors) Error() string {
+	var msgs []string
+	for shop, err := range errs {
+		msgs = append(msgs, shop+": "+err.Error())
+	}
+	sort.Strings(msgs)
+	return strings.Join(msgs, ", ")
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request is allowed or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(r.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(r)
+}
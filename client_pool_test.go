@@ -0,0 +1,162 @@
+package shopify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientPool(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	for _, shop := range []string{"shop1", "shop2", "shop3", "shop4"} {
+		store.SaveToken(ctx, shop, 0, &Oauth2Token{AccessToken: "shpat_" + shop})
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	pool := NewClientPool(store)
+	pool.Transport = newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		shop := strings.TrimPrefix(r.Header.Get("X-Shopify-Access-Token"), "shpat_")
+		if shop == "shop3" {
+			w.Write([]byte(`{"errors":[{"message":"Throttled"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"shop":{"name":"` + shop + `"}}}`))
+	})).Transport
+
+	c1, err := pool.Get(ctx, "shop1.myshopify.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2, _ := pool.Get(ctx, "shop1"); c2 != c1 {
+		t.Error("client should be cached")
+	}
+	if _, err := pool.Get(ctx, "unknown"); err != ErrTokenNotFound {
+		t.Error("should return ErrTokenNotFound")
+	}
+
+	var names []string
+	err = pool.Each(ctx, 2, func(ctx context.Context, client *Client) error {
+		var name string
+		err := client.New("{ shop { name } }").WithContext(ctx).Do(&name, "shop.name")
+		mu.Lock()
+		names = append(names, name)
+		mu.Unlock()
+		return err
+	})
+	var errs ShopErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs["shop3"] == nil {
+		t.Errorf("shop3 should fail: %v", err)
+	}
+	if len(names) != 4 || maxRunning != 2 {
+		t.Errorf("should run on 4 shops with concurrency 2, got %d and %d", len(names), maxRunning)
+	}
+	if pool.Len() != 4 {
+		t.Error("clients should be cached")
+	}
+
+	pool.IdleTimeout = -1
+	pool.EvictIdle()
+	if pool.Len() != 4 {
+		t.Error("negative idle timeout should disable eviction")
+	}
+	pool.IdleTimeout = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	pool.EvictIdle()
+	if pool.Len() != 0 {
+		t.Error("idle clients should be evicted")
+	}
+}
+
+func TestClientPoolDefaults(t *testing.T) {
+	pool := &ClientPool{Store: NewMemoryTokenStore()}
+	if rate, burst := pool.rateLimit(); rate != 2 || burst != 40 {
+		t.Errorf("zero rate limit should use defaults, got %v and %d", rate, burst)
+	}
+	pool.Store.SaveToken(context.Background(), "shop1", 0, &Oauth2Token{AccessToken: "shpat_shop1"})
+	client, err := pool.Get(context.Background(), "shop1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.httpClient.Transport.(*transport).base.Base.(*rateLimitedTransport); !ok {
+		t.Error("requests should be rate limited by default")
+	}
+	pool.mu.Lock()
+	pool.clients["shop1"].lastUsed = time.Now().Add(-11 * time.Minute)
+	pool.mu.Unlock()
+	pool.EvictIdle()
+	if pool.Len() != 0 {
+		t.Error("zero idle timeout should use the default")
+	}
+
+	pool = &ClientPool{Store: pool.Store, RateLimit: -1}
+	client, _ = pool.Get(context.Background(), "shop1")
+	if _, ok := client.httpClient.Transport.(*transport).base.Base.(*rateLimitedTransport); ok {
+		t.Error("negative rate limit should disable rate limiting")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("requests after burst should wait, elapsed %s", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Error("should return context error")
+	}
+}
+
+func TestClientPoolRefresh(t *testing.T) {
+	tokenServer := newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"shpat_new","expires_in":3600,"refresh_token":"shprt_new"}`))
+	}))
+	store := NewMemoryTokenStore()
+	store.SaveToken(context.Background(), "demo", 0, &Oauth2Token{
+		AccessToken:  "shpat_old",
+		RefreshToken: "shprt_old",
+		Expiry:       time.Now().Add(time.Second),
+	})
+	pool := NewClientPool(store)
+	pool.Config = &Oauth2Config{ClientID: "clientid", ClientSecret: testSecret}
+	pool.RefreshContext = context.WithValue(context.Background(), Oauth2HTTPClient, tokenServer)
+	pool.Transport = newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"shop":{"name":"` + r.Header.Get("X-Shopify-Access-Token") + `"}}}`))
+	})).Transport
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := pool.Get(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	var name string
+	if err := client.New("{ shop { name } }").Do(&name, "shop.name"); err != nil || name != "shpat_new" {
+		t.Fatalf("token should be refreshed after ctx of Get is done: %s %v", name, err)
+	}
+	if token, _ := store.LoadToken(context.Background(), "demo", 0); token == nil || token.AccessToken != "shpat_new" {
+		t.Error("refreshed token should be saved")
+	}
+}
@@ -3,9 +3,13 @@ package shopify
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/caiguanhao/shopify/graphql"
 )
 
 var client *Client
@@ -164,3 +168,47 @@ func toJSON(i interface{}) string {
 	b, _ := json.Marshal(i)
 	return string(b)
 }
+
+func TestValidateMinify(t *testing.T) {
+	var queries []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &req)
+		queries = append(queries, req.Query)
+		w.Write([]byte(`{"data":{"shop":{"name":"Demo"}}}`))
+	}))
+	c.Validate = true
+	c.Minify = true
+
+	const gql = `
+query getShop($n: Int) { # comment
+  shop { name }
+}`
+	err := c.New(gql, "n", 1).Do()
+	if _, ok := err.(*graphql.ValidationError); !ok {
+		t.Error("unused variable should fail validation:", err)
+	}
+	err = c.New("query { shop { name }").Do()
+	if _, ok := err.(*graphql.SyntaxError); !ok {
+		t.Error("syntax error should be returned:", err)
+	}
+	if len(queries) != 0 {
+		t.Error("invalid queries should not be sent")
+	}
+
+	req := c.New("query getShop {\n  shop { name }\n}")
+	if name, err := req.OperationName(); err != nil || name != "getShop" {
+		t.Error("operation name is not correct:", name, err)
+	}
+	var name string
+	if err := req.Do(&name, "shop.name"); err != nil || name != "Demo" {
+		t.Error("result is not correct:", name, err)
+	}
+	if len(queries) != 1 || queries[0] != "query getShop{shop{name}}" {
+		t.Error("query should be minified:", queries)
+	}
+	if req.Query != "query getShop {\n  shop { name }\n}" {
+		t.Error("query of request should not be changed")
+	}
+}
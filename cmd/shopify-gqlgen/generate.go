@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+type (
+	generator struct {
+		schema  *graphql.Schema
+		doc     *graphql.Document
+		pkg     string
+		decls   []string
+		names   map[string]bool // names of generated types and functions
+		imports map[string]bool
+		enums   map[string]bool // enums used, generated at the end
+		inputs  map[string]bool // input objects generated
+	}
+
+	// Fields of the same response name in a selection set, including the
+	// ones in inline fragments.
+	selectedField struct {
+		responseName string
+		def          *graphql.FieldDefinition // nil for __typename
+		fields       []*graphql.Field
+		selections   []graphql.Selection
+	}
+
+	// Function of a field with the @extract directive, which returns
+	// the field only, using the path of Request.Do.
+	extract struct {
+		name string
+		path string
+		typ  string
+	}
+)
+
+// generate returns the formatted Go source of types and functions of the
+// operations in src.
+func generate(pkg string, schema *graphql.Schema, src string) ([]byte, error) {
+	doc, err := graphql.ParseAndValidate(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(doc); err != nil {
+		return nil, err
+	}
+	g := &generator{
+		schema:  schema,
+		doc:     doc,
+		pkg:     pkg,
+		names:   map[string]bool{},
+		imports: map[string]bool{},
+		enums:   map[string]bool{},
+		inputs:  map[string]bool{},
+	}
+	for _, f := range doc.Fragments {
+		if err := g.fragment(f); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range doc.Operations {
+		if err := g.operation(op); err != nil {
+			return nil, err
+		}
+	}
+	var enums []string
+	for name := range g.enums {
+		enums = append(enums, name)
+	}
+	sort.Strings(enums)
+	for _, name := range enums {
+		if err := g.enum(name); err != nil {
+			return nil, err
+		}
+	}
+	return g.source()
+}
+
+func (g *generator) source() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("// Code generated by shopify-gqlgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", g.pkg)
+	if len(g.imports) > 0 {
+		var imports []string
+		for path := range g.imports {
+			imports = append(imports, path)
+		}
+		sort.Slice(imports, func(i, j int) bool { // standard library first
+			a, b := strings.Contains(imports[i], "."), strings.Contains(imports[j], ".")
+			if a != b {
+				return b
+			}
+			return imports[i] < imports[j]
+		})
+		b.WriteString("import (\n")
+		for i, path := range imports {
+			if i > 0 && strings.Contains(path, ".") && !strings.Contains(imports[i-1], ".") {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "\t%q\n", path)
+		}
+		b.WriteString(")\n")
+	}
+	for _, decl := range g.decls {
+		b.WriteString("\n" + decl)
+	}
+	return format.Source([]byte(b.String()))
+}
+
+func (g *generator) operation(op *graphql.Operation) error {
+	if op.Name == "" {
+		return fmt.Errorf("%s must have a name", op)
+	}
+	if op.Type == "subscription" {
+		return fmt.Errorf("%s is not supported", op)
+	}
+	name := exportName(op.Name)
+	for _, n := range []string{name, name + "Query", name + "Variables", name + "Response"} {
+		if err := g.declare(n); err != nil {
+			return err
+		}
+	}
+
+	root := g.schema.RootType(op.Type)
+	if root == nil {
+		return fmt.Errorf("schema has no %s type", op.Type)
+	}
+	var extracts []extract
+	decls := g.decls
+	g.decls = nil
+	if err := g.structType(name+"Response", name, root, op.SelectionSet, nil, &extracts); err != nil {
+		return err
+	}
+	g.decls[0] = fmt.Sprintf("// %sResponse is the response of the %s.\n", name, op) + g.decls[0]
+	response := g.decls
+	g.decls = decls
+	for _, e := range extracts {
+		if err := g.declare(e.name); err != nil {
+			return err
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %sQuery is the document of the %s.\n", name, op)
+	fmt.Fprintf(&b, "const %sQuery = %s\n", name, quote(g.document(op)))
+	g.decls = append(g.decls, b.String())
+
+	params, args := "", ""
+	if len(op.VariableDefinitions) > 0 {
+		if err := g.variables(name, op.VariableDefinitions); err != nil {
+			return err
+		}
+		params, args = ", vars "+name+"Variables", ", vars.args()..."
+	}
+	g.imports["context"] = true
+	g.imports["github.com/caiguanhao/shopify"] = true
+
+	b.Reset()
+	fmt.Fprintf(&b, "// %s executes the %s.\n", name, op)
+	fmt.Fprintf(&b, "func %s(ctx context.Context, client *shopify.Client%s) (*%sResponse, error) {\n", name, params, name)
+	fmt.Fprintf(&b, "\tvar resp %sResponse\n", name)
+	fmt.Fprintf(&b, "\tif err := client.New(%sQuery%s).WithContext(ctx).Do(&resp); err != nil {\n", name, args)
+	b.WriteString("\t\treturn nil, err\n\t}\n\treturn &resp, nil\n}\n")
+	g.decls = append(g.decls, b.String())
+
+	for _, e := range extracts {
+		b.Reset()
+		fmt.Fprintf(&b, "// %s executes the %s and returns %s.\n", e.name, op, e.path)
+		fmt.Fprintf(&b, "func %s(ctx context.Context, client *shopify.Client%s) (%s, error) {\n", e.name, params, e.typ)
+		fmt.Fprintf(&b, "\tvar dest %s\n", e.typ)
+		fmt.Fprintf(&b, "\terr := client.New(%sQuery%s).WithContext(ctx).Do(&dest, %q)\n", name, args, e.path)
+		b.WriteString("\treturn dest, err\n}\n")
+		g.decls = append(g.decls, b.String())
+	}
+	g.decls = append(g.decls, response...)
+	return nil
+}
+
+// document returns the operation and fragments used by it.
+func (g *generator) document(op *graphql.Operation) string {
+	used := map[string]bool{}
+	var walk func([]graphql.Selection)
+	walk = func(selections []graphql.Selection) {
+		for _, selection := range selections {
+			switch s := selection.(type) {
+			case *graphql.Field:
+				walk(s.SelectionSet)
+			case *graphql.InlineFragment:
+				walk(s.SelectionSet)
+			case *graphql.FragmentSpread:
+				if !used[s.Name] {
+					used[s.Name] = true
+					walk(g.doc.Fragment(s.Name).SelectionSet)
+				}
+			}
+		}
+	}
+	walk(op.SelectionSet)
+	doc := &graphql.Document{Operations: []*graphql.Operation{op}}
+	for _, f := range g.doc.Fragments {
+		if used[f.Name] {
+			doc.Fragments = append(doc.Fragments, f)
+		}
+	}
+	return strings.TrimSuffix(doc.String(), "\n")
+}
+
+func (g *generator) fragment(f *graphql.Fragment) error {
+	name := exportName(f.Name)
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	t := g.schema.Type(f.TypeCondition)
+	if t == nil {
+		return fmt.Errorf("unknown type %s of fragment %s", f.TypeCondition, f.Name)
+	}
+	return g.structType(name, name, t, f.SelectionSet, nil, nil)
+}
+
+// structType generates the struct of the selection set. Types of fields are
+// named by the prefix and the response names. Fields with @extract are put
+// into extracts, which is nil in fragments.
+func (g *generator) structType(name, prefix string, parent *graphql.Type, selections []graphql.Selection, path []string, extracts *[]extract) error {
+	var fields []*selectedField
+	var embeds []string
+	if err := g.collect(parent, selections, &fields, &embeds); err != nil {
+		return err
+	}
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	for _, embed := range embeds {
+		fmt.Fprintf(&b, "\t%s\n", embed)
+	}
+	for _, f := range fields {
+		typ, err := g.fieldType(prefix, f, path, extracts)
+		if err != nil {
+			return err
+		}
+		if f.def != nil && f.def.IsDeprecated {
+			fmt.Fprintf(&b, "\t%s\n", deprecation(f.def.DeprecationReason))
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:\"%s\"`\n", exportName(f.responseName), typ, f.responseName)
+	}
+	b.WriteString("}\n")
+	g.decls[index] = b.String()
+	return nil
+}
+
+// collect merges fields of the selection set by response name, and returns
+// names of fragments spread in it.
+func (g *generator) collect(parent *graphql.Type, selections []graphql.Selection, fields *[]*selectedField, embeds *[]string) error {
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *graphql.Field:
+			responseName := s.Name
+			if s.Alias != "" {
+				responseName = s.Alias
+			}
+			var f *selectedField
+			for _, field := range *fields {
+				if field.responseName == responseName {
+					f = field
+				}
+			}
+			if f == nil {
+				f = &selectedField{responseName: responseName}
+				if s.Name != "__typename" {
+					if f.def = parent.Field(s.Name); f.def == nil {
+						return fmt.Errorf("unknown field %s on %s", s.Name, parent.Name)
+					}
+				}
+				*fields = append(*fields, f)
+			}
+			f.fields = append(f.fields, s)
+			f.selections = append(f.selections, s.SelectionSet...)
+		case *graphql.InlineFragment:
+			t := parent
+			if s.TypeCondition != "" {
+				if t = g.schema.Type(s.TypeCondition); t == nil {
+					return fmt.Errorf("unknown type %s", s.TypeCondition)
+				}
+			}
+			if err := g.collect(t, s.SelectionSet, fields, embeds); err != nil {
+				return err
+			}
+		case *graphql.FragmentSpread:
+			name := exportName(s.Name)
+			for _, embed := range *embeds {
+				if embed == name {
+					name = ""
+				}
+			}
+			if name != "" {
+				*embeds = append(*embeds, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) fieldType(prefix string, f *selectedField, path []string, extracts *[]extract) (string, error) {
+	if f.def == nil {
+		return "string", nil // __typename
+	}
+	path = append(append([]string(nil), path...), f.responseName)
+	for t := f.def.Type; t != nil; t = t.OfType {
+		if t.Kind == graphql.KindList {
+			path = append(path, "*")
+		}
+	}
+	named := g.schema.Type(f.def.Type.NamedType())
+	if named == nil {
+		return "", fmt.Errorf("unknown type %s", f.def.Type.NamedType())
+	}
+	var elem string
+	if named.IsLeaf() {
+		elem = g.leafType(named)
+	} else {
+		elem = prefix + exportName(f.responseName)
+		if err := g.declare(elem); err != nil {
+			return "", err
+		}
+		if err := g.structType(elem, elem, named, f.selections, path, extracts); err != nil {
+			return "", err
+		}
+	}
+
+	for _, field := range f.fields {
+		for _, d := range field.Directives {
+			if d.Name != "extract" {
+				continue
+			}
+			if extracts == nil {
+				return "", fmt.Errorf("@extract of %s is not allowed in fragments", f.responseName)
+			}
+			e := extract{path: strings.Join(path, "."), typ: elem}
+			if strings.Contains(e.path, "*") {
+				e.typ = "[]" + elem
+			}
+			for _, arg := range d.Arguments {
+				if arg.Name == "name" {
+					e.name, _ = strconv.Unquote(arg.Value)
+				}
+			}
+			if e.name == "" {
+				return "", fmt.Errorf("@extract of %s must have a name, like @extract(name: \"GetProducts\")", e.path)
+			}
+			*extracts = append(*extracts, e)
+		}
+		field.Directives = removeExtract(field.Directives)
+	}
+	return goType(f.def.Type, elem, !named.IsLeaf()), nil
+}
+
+// variables generates the struct of the variables and its args method, which
+// returns key-value pairs for Client.New. Optional variables are omitted if
+// nil, so that default values are used.
+func (g *generator) variables(name string, definitions []*graphql.VariableDefinition) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %sVariables struct {\n", name)
+	var args strings.Builder
+	fmt.Fprintf(&args, "func (vars %sVariables) args() (args []interface{}) {\n", name)
+	for _, v := range definitions {
+		ref, err := graphql.ParseTypeRef(v.Type)
+		if err != nil {
+			return err
+		}
+		optional := ref.Kind != graphql.KindNonNull || v.DefaultValue != ""
+		if ref.Kind == graphql.KindNonNull && optional {
+			ref = ref.OfType
+		}
+		typ, err := g.inputType(ref)
+		if err != nil {
+			return err
+		}
+		field := exportName(v.Name)
+		fmt.Fprintf(&b, "\t%s %s\n", field, typ)
+		if optional {
+			fmt.Fprintf(&args, "\tif vars.%s != nil {\n\t\targs = append(args, %q, vars.%s)\n\t}\n", field, v.Name, field)
+		} else {
+			fmt.Fprintf(&args, "\targs = append(args, %q, vars.%s)\n", v.Name, field)
+		}
+	}
+	b.WriteString("}\n\n")
+	args.WriteString("\treturn\n}\n")
+	g.decls = append(g.decls, b.String()+args.String())
+	return nil
+}
+
+// inputType returns the Go type of the input type, and generates the input
+// object if needed. Nullable types are pointers or slices.
+func (g *generator) inputType(ref *graphql.TypeRef) (string, error) {
+	named := g.schema.Type(ref.NamedType())
+	if named == nil {
+		return "", fmt.Errorf("unknown type %s", ref.NamedType())
+	}
+	if named.IsLeaf() {
+		return goType(ref, g.leafType(named), true), nil
+	}
+	name := exportName(named.Name)
+	if !g.inputs[named.Name] {
+		g.inputs[named.Name] = true
+		if err := g.declare(name); err != nil {
+			return "", err
+		}
+		index := len(g.decls)
+		g.decls = append(g.decls, "")
+		var b strings.Builder
+		fmt.Fprintf(&b, "type %s struct {\n", name)
+		for _, f := range named.InputFields {
+			typ, err := g.inputType(f.Type)
+			if err != nil {
+				return "", err
+			}
+			tag := f.Name
+			if f.Type.Kind != graphql.KindNonNull {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:\"%s\"`\n", exportName(f.Name), typ, tag)
+		}
+		b.WriteString("}\n")
+		g.decls[index] = b.String()
+	}
+	return goType(ref, name, true), nil
+}
+
+func (g *generator) enum(name string) error {
+	t := g.schema.Type(name)
+	if t == nil {
+		return fmt.Errorf("unknown type %s", name)
+	}
+	typ := exportName(name)
+	if err := g.declare(typ); err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s string\n\nconst (\n", typ)
+	for _, v := range t.EnumValues {
+		if v.IsDeprecated {
+			fmt.Fprintf(&b, "\t%s\n", deprecation(v.DeprecationReason))
+		}
+		fmt.Fprintf(&b, "\t%s%s %s = %q\n", typ, enumValueName(v.Name), typ, v.Name)
+	}
+	b.WriteString(")\n")
+	g.decls = append(g.decls, b.String())
+	return nil
+}
+
+// leafType returns the Go type of the scalar or enum.
+func (g *generator) leafType(t *graphql.Type) string {
+	if t.Kind == graphql.KindEnum {
+		g.enums[t.Name] = true
+		return exportName(t.Name)
+	}
+	switch t.Name {
+	case "Int":
+		return "int"
+	case "Float":
+		return "float64"
+	case "Boolean":
+		return "bool"
+	case "DateTime":
+		g.imports["time"] = true
+		return "time.Time"
+	case "JSON":
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	return "string" // ID, String and other custom scalars
+}
+
+func (g *generator) declare(name string) error {
+	if g.names[name] {
+		return fmt.Errorf("duplicate name %s", name)
+	}
+	g.names[name] = true
+	return nil
+}
+
+// goType returns the Go type of the GraphQL type. Nullable types which are
+// not lists are pointers if pointer is true.
+func goType(ref *graphql.TypeRef, named string, pointer bool) string {
+	nonNull := ref.Kind == graphql.KindNonNull
+	if nonNull {
+		ref = ref.OfType
+	}
+	if ref.Kind == graphql.KindList {
+		return "[]" + goType(ref.OfType, named, pointer)
+	}
+	if pointer && !nonNull {
+		return "*" + named
+	}
+	return named
+}
+
+func removeExtract(directives []*graphql.Directive) (out []*graphql.Directive) {
+	for _, d := range directives {
+		if d.Name != "extract" {
+			out = append(out, d)
+		}
+	}
+	return
+}
+
+// exportName converts a GraphQL name like "productUpdate" or "__typename"
+// into an exported Go name like "ProductUpdate" or "Typename".
+func exportName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	if b.Len() == 0 || b.String()[0] >= '0' && b.String()[0] <= '9' {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// enumValueName converts an enum value like "CREATED_AT" into "CreatedAt".
+func enumValueName(value string) string {
+	return exportName(strings.ToLower(value))
+}
+
+func deprecation(reason string) string {
+	reason = strings.Join(strings.Fields(reason), " ")
+	if reason == "" {
+		return "// Deprecated."
+	}
+	return "// Deprecated: " + reason
+}
+
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	schema, err := graphql.ReadSchemaFile("testdata/schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob("testdata/*.graphql")
+	var sources []string
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(b))
+	}
+	out, err := generate("admin", schema, strings.Join(sources, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const golden = "testdata/generated.go.golden"
+	if *update {
+		if err := ioutil.WriteFile(golden, out, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(expected) {
+		t.Errorf("generated code is not correct, run go test -update to see the difference:\n%s", out)
+	}
+
+	for src, message := range map[string]string{
+		`{ shop { name } }`:                                                         "anonymous query must have a name",
+		`query getShop { shop { foo } }`:                                            "graphql: query getShop: shop: unknown field foo on Shop",
+		`query a { shop { name } } query A { shop { name } }`:                       "duplicate name A",
+		`query a { shop @extract { name } }`:                                        "@extract of shop must have a name, like @extract(name: \"GetProducts\")",
+		`query a { shop { ...F } } fragment F on Shop { name @extract(name: "X") }`: "@extract of name is not allowed in fragments",
+		`fragment F on Nope { a }`:                                                  "graphql: fragment F: unknown type Nope",
+		`fragment F on Shop { nope }`:                                               "graphql: fragment F: unknown field nope on Shop",
+	} {
+		if _, err := generate("admin", schema, src); err == nil || err.Error() != message {
+			t.Errorf("%q has wrong error: %v", src, err)
+		}
+	}
+}
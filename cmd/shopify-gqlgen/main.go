@@ -0,0 +1,70 @@
+// Command shopify-gqlgen generates Go types and functions from GraphQL
+// operations in .graphql files, checked against an Admin API schema saved
+// with Client.Introspect and Schema.WriteFile.
+//
+// Usage:
+//
+//	shopify-gqlgen -schema schema/2021-10.json -package admin -o admin/generated.go queries/*.graphql
+//
+// For each named operation like "query getProducts", it generates the
+// document GetProductsQuery, the response type GetProductsResponse, the
+// variables type GetProductsVariables and the function GetProducts. Add
+// @extract(name: "ListProducts") to a field to generate a function which
+// returns the field only, like Request.Do with a path. The directive is
+// removed from the document.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+func main() {
+	schemaFile := flag.String("schema", "", "schema file saved by Schema.WriteFile (required)")
+	pkg := flag.String("package", "main", "package name of the generated file")
+	output := flag.String("o", "", "output file, print to standard output if empty")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: shopify-gqlgen -schema FILE [-package NAME] [-o FILE] FILE.graphql...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *schemaFile == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.SetFlags(0)
+	log.SetPrefix("shopify-gqlgen: ")
+
+	schema, err := graphql.ReadSchemaFile(*schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var sources []string
+	for _, name := range flag.Args() {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := graphql.Parse(string(b)); err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+		sources = append(sources, string(b))
+	}
+	src, err := generate(*pkg, schema, strings.Join(sources, "\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
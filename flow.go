@@ -0,0 +1,98 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Shopify rejects Flow trigger payloads larger than 50 KB.
+const maxFlowTriggerPayloadSize = 50000
+
+var (
+	ErrFlowPayloadTooLarge = errors.New("flow trigger payload is larger than 50 KB")
+)
+
+type (
+	// Request of a Flow action sent to the app's action endpoint.
+	FlowAction struct {
+		ShopId             int64           `json:"shop_id"`
+		ShopifyDomain      string          `json:"shopify_domain"`
+		ActionRunId        string          `json:"action_run_id"`
+		ActionDefinitionId string          `json:"action_definition_id"`
+		Handle             string          `json:"handle"`
+		Properties         json.RawMessage `json:"properties"`
+	}
+
+	// FlowActionHandler serves the endpoint of Flow actions. Requests are
+	// verified and decoded before calling Action. If Action returns an
+	// error, a 500 status is written and Flow retries the action later. If
+	// Action is nil, 404 is returned.
+	FlowActionHandler struct {
+		// API secret key of the app, used to verify requests.
+		ClientSecret string
+
+		Action func(ctx context.Context, shop string, action *FlowAction) error
+	}
+)
+
+// Decode unmarshals properties of the action into v.
+func (a *FlowAction) Decode(v interface{}) error {
+	if len(a.Properties) == 0 {
+		return nil
+	}
+	return json.Unmarshal(a.Properties, v)
+}
+
+func (h *FlowActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Action == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := VerifyWebhook(r, h.ClientSecret)
+	if err != nil {
+		writeVerifyError(w, err)
+		return
+	}
+	var action FlowAction
+	if err := json.Unmarshal(body, &action); err != nil {
+		http.Error(w, "invalid flow action", http.StatusBadRequest)
+		return
+	}
+	shop, err := ShopFromDomain(action.ShopifyDomain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Action(r.Context(), shop, &action); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// FlowTrigger wraps FlowTriggerWithContext using context.Background.
+func (client *Client) FlowTrigger(handle string, payload interface{}) error {
+	return client.FlowTriggerWithContext(context.Background(), handle, payload)
+}
+
+// Start workflows of the trigger of the handle with the payload, which is
+// marshaled to JSON and must not be larger than 50 KB.
+func (client *Client) FlowTriggerWithContext(ctx context.Context, handle string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxFlowTriggerPayloadSize {
+		return fmt.Errorf("%w: %d bytes", ErrFlowPayloadTooLarge, len(b))
+	}
+	return client.New(`mutation ($handle: String, $payload: JSON) {
+flowTriggerReceive(handle: $handle, payload: $payload) {
+  userErrors { field message }
+} }`, "handle", handle, "payload", json.RawMessage(b)).WithContext(ctx).Do()
+}
@@ -0,0 +1,79 @@
+package shopify
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlowActionHandler(t *testing.T) {
+	var shop string
+	var props struct {
+		OrderId int64  `json:"order_id"`
+		Note    string `json:"note"`
+	}
+	h := &FlowActionHandler{
+		ClientSecret: testSecret,
+		Action: func(ctx context.Context, s string, action *FlowAction) error {
+			shop = s
+			if action.Handle != "add-note" {
+				return errors.New("unknown action")
+			}
+			return action.Decode(&props)
+		},
+	}
+
+	body := `{"shop_id":1,"shopify_domain":"demo.myshopify.com","action_run_id":"run","handle":"add-note",
+"properties":{"order_id":1001,"note":"hello"}}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/flow", body))
+	if w.Code != http.StatusOK || shop != "demo" || props.OrderId != 1001 || props.Note != "hello" {
+		t.Errorf("action should be decoded, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/flow", strings.Replace(body, "add-note", "other", 1)))
+	if w.Code != http.StatusInternalServerError {
+		t.Error("failed action should be retried")
+	}
+
+	r := newSignedRequest("POST", "/flow", body)
+	r.Header.Set("X-Shopify-Hmac-Sha256", "invalid")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("unsigned action should be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	(&FlowActionHandler{ClientSecret: testSecret}).ServeHTTP(w, newSignedRequest("POST", "/flow", body))
+	if w.Code != http.StatusNotFound {
+		t.Error("handler without action should not be found")
+	}
+}
+
+func TestFlowTrigger(t *testing.T) {
+	var query string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		query = string(b)
+		w.Write([]byte(`{"data":{"flowTriggerReceive":{"userErrors":[]}}}`))
+	}))
+	err := c.FlowTrigger("order-reviewed", KV{"order_id": 1001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `"handle":"order-reviewed"`) || !strings.Contains(query, `"payload":{"order_id":1001}`) {
+		t.Errorf("trigger is not sent correctly: %s", query)
+	}
+
+	query = ""
+	err = c.FlowTrigger("order-reviewed", KV{"note": strings.Repeat("a", maxFlowTriggerPayloadSize)})
+	if !errors.Is(err, ErrFlowPayloadTooLarge) || query != "" {
+		t.Error("large payload should not be sent")
+	}
+}
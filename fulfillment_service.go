@@ -0,0 +1,297 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Kinds of fulfillment order notifications.
+	FulfillmentRequestKind  = "FULFILLMENT_REQUEST"
+	CancellationRequestKind = "CANCELLATION_REQUEST"
+
+	// Assignment statuses of fulfillment orders.
+	FulfillmentRequested  = "FULFILLMENT_REQUESTED"
+	FulfillmentAccepted   = "FULFILLMENT_ACCEPTED"
+	CancellationRequested = "CANCELLATION_REQUESTED"
+)
+
+type (
+	// FulfillmentServiceHandler serves the callback url of a fulfillment
+	// service. Requests to "<callback_url>/fetch_tracking_numbers",
+	// "<callback_url>/fetch_stock" and
+	// "<callback_url>/fulfillment_order_notification" are passed to
+	// the corresponding function. Paths of functions not set return 404.
+	// Fetch requests must have the hmac query param and notifications the
+	// X-Shopify-Hmac-Sha256 header, otherwise 401 is returned.
+	FulfillmentServiceHandler struct {
+		// API secret key of the app, used to verify requests. Requests are
+		// rejected if it is empty.
+		ClientSecret string
+
+		// Return tracking numbers of fulfillments by order names, like
+		// "#1001.1".
+		TrackingNumbers func(ctx context.Context, shop string, orderNames []string) (map[string]string, error)
+
+		// Return inventory levels by sku. If skus is empty, return levels
+		// of all skus.
+		Stock func(ctx context.Context, shop string, skus []string) (map[string]int, error)
+
+		// Called when fulfillment or cancellation of fulfillment orders is
+		// requested. Use AssignedFulfillmentOrders to get the orders.
+		Notification func(ctx context.Context, shop string, notification *FulfillmentOrderNotification) error
+	}
+
+	FulfillmentOrderNotification struct {
+		Kind string `json:"kind"` // FulfillmentRequestKind or CancellationRequestKind
+	}
+
+	TrackingNumbersResponse struct {
+		TrackingNumbers map[string]string `json:"tracking_numbers"`
+		Message         string            `json:"message"`
+		Success         bool              `json:"success"`
+	}
+
+	FulfillmentOrder struct {
+		Id            string                     `json:"id"`
+		Status        string                     `json:"status"`
+		RequestStatus string                     `json:"requestStatus"`
+		OrderName     string                     `json:"orderName"`
+		LineItems     []FulfillmentOrderLineItem `json:"lineItems"`
+	}
+
+	FulfillmentOrderLineItem struct {
+		Id                string `json:"id"`
+		Sku               string `json:"sku"`
+		RemainingQuantity int    `json:"remainingQuantity"`
+	}
+
+	// Tracking info of a fulfillment.
+	TrackingInfo struct {
+		Company string `json:"company,omitempty"`
+		Number  string `json:"number,omitempty"`
+		URL     string `json:"url,omitempty"`
+	}
+
+	fulfillmentOrderNode struct {
+		Id            string `json:"id"`
+		Status        string `json:"status"`
+		RequestStatus string `json:"requestStatus"`
+		Order         struct {
+			Name string `json:"name"`
+		} `json:"order"`
+		LineItems struct {
+			Edges []struct {
+				Node struct {
+					Id                string `json:"id"`
+					RemainingQuantity int    `json:"remainingQuantity"`
+					LineItem          struct {
+						Sku string `json:"sku"`
+					} `json:"lineItem"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"lineItems"`
+	}
+)
+
+func (h *FulfillmentServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/fetch_tracking_numbers") && h.TrackingNumbers != nil:
+		shop, ok := h.verifyQuery(w, query)
+		if !ok {
+			return
+		}
+		numbers, err := h.TrackingNumbers(r.Context(), shop, query["order_names[]"])
+		resp := TrackingNumbersResponse{
+			TrackingNumbers: numbers,
+			Message:         "Successfully received the tracking numbers",
+			Success:         err == nil,
+		}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if resp.TrackingNumbers == nil {
+			resp.TrackingNumbers = map[string]string{}
+		}
+		writeJSON(w, resp)
+	case strings.HasSuffix(r.URL.Path, "/fetch_stock") && h.Stock != nil:
+		shop, ok := h.verifyQuery(w, query)
+		if !ok {
+			return
+		}
+		var skus []string
+		if sku := query.Get("sku"); sku != "" {
+			skus = []string{sku}
+		}
+		stock, err := h.Stock(r.Context(), shop, skus)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if stock == nil {
+			stock = map[string]int{}
+		}
+		writeJSON(w, stock)
+	case strings.HasSuffix(r.URL.Path, "/fulfillment_order_notification") && h.Notification != nil:
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, err := VerifyWebhook(r, h.ClientSecret); err != nil {
+			writeVerifyError(w, err)
+			return
+		}
+		shop, err := ShopFromDomain(r.Header.Get("X-Shopify-Shop-Domain"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var notification FulfillmentOrderNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+		if err := h.Notification(r.Context(), shop, &notification); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verifyQuery verifies the hmac query param of a fetch request and returns
+// the shop in the query.
+func (h *FulfillmentServiceHandler) verifyQuery(w http.ResponseWriter, query url.Values) (string, bool) {
+	if h.ClientSecret == "" {
+		writeVerifyError(w, ErrNoClientSecret)
+		return "", false
+	}
+	if !VerifyOauth2HMAC(query, h.ClientSecret) {
+		writeVerifyError(w, ErrInvalidHMAC)
+		return "", false
+	}
+	shop, err := ShopFromDomain(query.Get("shop"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return shop, true
+}
+
+// AssignedFulfillmentOrders wraps AssignedFulfillmentOrdersWithContext using
+// context.Background.
+func (client *Client) AssignedFulfillmentOrders(assignmentStatus string) ([]FulfillmentOrder, error) {
+	return client.AssignedFulfillmentOrdersWithContext(context.Background(), assignmentStatus)
+}
+
+// Return the first 50 fulfillment orders assigned to the app's fulfillment
+// service with the assignment status, like FulfillmentRequested.
+func (client *Client) AssignedFulfillmentOrdersWithContext(ctx context.Context, assignmentStatus string) (orders []FulfillmentOrder, err error) {
+	var nodes []fulfillmentOrderNode
+	err = client.New(`query ($status: FulfillmentOrderAssignmentStatus) {
+shop { assignedFulfillmentOrders(first: 50, assignmentStatus: $status) { edges { node {
+id status requestStatus order { name }
+lineItems(first: 50) { edges { node { id remainingQuantity lineItem { sku } } } }
+} } } } }`, "status", assignmentStatus).WithContext(ctx).
+		Do(&nodes, "shop.assignedFulfillmentOrders.edges.*.node")
+	for _, node := range nodes {
+		order := FulfillmentOrder{
+			Id:            node.Id,
+			Status:        node.Status,
+			RequestStatus: node.RequestStatus,
+			OrderName:     node.Order.Name,
+		}
+		for _, edge := range node.LineItems.Edges {
+			order.LineItems = append(order.LineItems, FulfillmentOrderLineItem{
+				Id:                edge.Node.Id,
+				Sku:               edge.Node.LineItem.Sku,
+				RemainingQuantity: edge.Node.RemainingQuantity,
+			})
+		}
+		orders = append(orders, order)
+	}
+	return
+}
+
+// AcceptFulfillmentRequest wraps AcceptFulfillmentRequestWithContext using
+// context.Background.
+func (client *Client) AcceptFulfillmentRequest(id, message string) error {
+	return client.AcceptFulfillmentRequestWithContext(context.Background(), id, message)
+}
+
+// Accept the fulfillment request of a fulfillment order.
+func (client *Client) AcceptFulfillmentRequestWithContext(ctx context.Context, id, message string) error {
+	return client.fulfillmentOrderRequest(ctx, "fulfillmentOrderAcceptFulfillmentRequest", id, message)
+}
+
+// RejectFulfillmentRequest wraps RejectFulfillmentRequestWithContext using
+// context.Background.
+func (client *Client) RejectFulfillmentRequest(id, message string) error {
+	return client.RejectFulfillmentRequestWithContext(context.Background(), id, message)
+}
+
+// Reject the fulfillment request of a fulfillment order.
+func (client *Client) RejectFulfillmentRequestWithContext(ctx context.Context, id, message string) error {
+	return client.fulfillmentOrderRequest(ctx, "fulfillmentOrderRejectFulfillmentRequest", id, message)
+}
+
+// AcceptCancellationRequest wraps AcceptCancellationRequestWithContext using
+// context.Background.
+func (client *Client) AcceptCancellationRequest(id, message string) error {
+	return client.AcceptCancellationRequestWithContext(context.Background(), id, message)
+}
+
+// Accept the cancellation request of a fulfillment order.
+func (client *Client) AcceptCancellationRequestWithContext(ctx context.Context, id, message string) error {
+	return client.fulfillmentOrderRequest(ctx, "fulfillmentOrderAcceptCancellationRequest", id, message)
+}
+
+// RejectCancellationRequest wraps RejectCancellationRequestWithContext using
+// context.Background.
+func (client *Client) RejectCancellationRequest(id, message string) error {
+	return client.RejectCancellationRequestWithContext(context.Background(), id, message)
+}
+
+// Reject the cancellation request of a fulfillment order.
+func (client *Client) RejectCancellationRequestWithContext(ctx context.Context, id, message string) error {
+	return client.fulfillmentOrderRequest(ctx, "fulfillmentOrderRejectCancellationRequest", id, message)
+}
+
+// CreateFulfillment wraps CreateFulfillmentWithContext using
+// context.Background.
+func (client *Client) CreateFulfillment(fulfillmentOrderId string, tracking TrackingInfo, notifyCustomer bool) (string, error) {
+	return client.CreateFulfillmentWithContext(context.Background(), fulfillmentOrderId, tracking, notifyCustomer)
+}
+
+// Fulfill all remaining line items of a fulfillment order with the tracking
+// info and return the id of the fulfillment.
+func (client *Client) CreateFulfillmentWithContext(ctx context.Context, fulfillmentOrderId string, tracking TrackingInfo, notifyCustomer bool) (id string, err error) {
+	err = client.New(`mutation ($fulfillment: FulfillmentV2Input!) {
+fulfillmentCreateV2(fulfillment: $fulfillment) {
+  userErrors { field message }
+  fulfillment { id }
+} }`, "fulfillment", KV{
+		"lineItemsByFulfillmentOrder": []KV{{"fulfillmentOrderId": fulfillmentOrderId}},
+		"trackingInfo":                tracking,
+		"notifyCustomer":              notifyCustomer,
+	}).WithContext(ctx).Do(&id, "fulfillmentCreateV2.fulfillment.id")
+	return
+}
+
+func (client *Client) fulfillmentOrderRequest(ctx context.Context, mutation, id, message string) error {
+	return client.New(`mutation ($id: ID!, $message: String) {
+`+mutation+`(id: $id, message: $message) {
+  userErrors { field message }
+  fulfillmentOrder { id }
+} }`, "id", id, "message", message).WithContext(ctx).Do()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,150 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFulfillmentServiceHandler(t *testing.T) {
+	var kind string
+	h := &FulfillmentServiceHandler{
+		ClientSecret: testSecret,
+		TrackingNumbers: func(ctx context.Context, shop string, orderNames []string) (map[string]string, error) {
+			if shop != "demo" {
+				return nil, errors.New("wrong shop")
+			}
+			numbers := map[string]string{}
+			for _, name := range orderNames {
+				numbers[name] = "TRACK" + strings.TrimPrefix(name, "#")
+			}
+			return numbers, nil
+		},
+		Stock: func(ctx context.Context, shop string, skus []string) (map[string]int, error) {
+			if len(skus) == 0 {
+				return map[string]int{"A": 1, "B": 2}, nil
+			}
+			return map[string]int{skus[0]: 5}, nil
+		},
+		Notification: func(ctx context.Context, shop string, n *FulfillmentOrderNotification) error {
+			kind = n.Kind
+			return nil
+		},
+	}
+
+	fetch := func(path string, query url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path+"?"+query.Encode(), nil))
+		return w
+	}
+
+	w := fetch("/fulfillment/fetch_tracking_numbers", signQuery(url.Values{
+		"order_names[]": {"#1001.1", "#1002.1"},
+		"shop":          {"demo.myshopify.com"},
+	}))
+	var tracking TrackingNumbersResponse
+	json.Unmarshal(w.Body.Bytes(), &tracking)
+	if !tracking.Success || len(tracking.TrackingNumbers) != 2 || tracking.TrackingNumbers["#1001.1"] != "TRACK1001.1" {
+		t.Errorf("tracking numbers are not correct: %s", w.Body.String())
+	}
+
+	w = fetch("/fulfillment/fetch_stock", signQuery(url.Values{"shop": {"demo.myshopify.com"}}))
+	if strings.TrimSpace(w.Body.String()) != `{"A":1,"B":2}` {
+		t.Errorf("stock of all skus is not correct: %s", w.Body.String())
+	}
+	w = fetch("/fulfillment/fetch_stock", signQuery(url.Values{"sku": {"C"}, "shop": {"demo.myshopify.com"}}))
+	if strings.TrimSpace(w.Body.String()) != `{"C":5}` {
+		t.Errorf("stock of sku is not correct: %s", w.Body.String())
+	}
+	if w = fetch("/fulfillment/fetch_stock", url.Values{"shop": {"demo.myshopify.com"}}); w.Code != http.StatusUnauthorized {
+		t.Error("unsigned fetch request should be rejected")
+	}
+	tampered := signQuery(url.Values{"shop": {"demo.myshopify.com"}})
+	tampered.Set("shop", "other.myshopify.com")
+	if w = fetch("/fulfillment/fetch_tracking_numbers", tampered); w.Code != http.StatusUnauthorized {
+		t.Error("tampered fetch request should be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/fulfillment/fulfillment_order_notification", `{"kind":"FULFILLMENT_REQUEST"}`))
+	if w.Code != http.StatusOK || kind != FulfillmentRequestKind {
+		t.Errorf("notification should be handled, got %d", w.Code)
+	}
+	r := newSignedRequest("POST", "/fulfillment/fulfillment_order_notification", `{"kind":"FULFILLMENT_REQUEST"}`)
+	r.Header.Set("X-Shopify-Hmac-Sha256", "invalid")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("unsigned notification should be rejected")
+	}
+
+	h.ClientSecret = ""
+	if w = fetch("/fulfillment/fetch_stock", signQuery(url.Values{"shop": {"demo.myshopify.com"}})); w.Code != http.StatusInternalServerError {
+		t.Error("fetch request should be rejected without client secret")
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newSignedRequest("POST", "/fulfillment/fulfillment_order_notification", `{"kind":"FULFILLMENT_REQUEST"}`))
+	if w.Code != http.StatusInternalServerError {
+		t.Error("notification should be rejected without client secret")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/fulfillment/other", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("unknown path should not be found")
+	}
+}
+
+func TestFulfillmentOrders(t *testing.T) {
+	var queries []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, string(b))
+		switch {
+		case strings.Contains(string(b), "assignedFulfillmentOrders"):
+			w.Write([]byte(`{"data":{"shop":{"assignedFulfillmentOrders":{"edges":[{"node":{
+"id":"gid://shopify/FulfillmentOrder/1","status":"OPEN","requestStatus":"SUBMITTED","order":{"name":"#1001"},
+"lineItems":{"edges":[{"node":{"id":"gid://shopify/FulfillmentOrderLineItem/2","remainingQuantity":3,"lineItem":{"sku":"A"}}}]}
+}}]}}}}`))
+		case strings.Contains(string(b), "fulfillmentOrderAcceptFulfillmentRequest"):
+			w.Write([]byte(`{"data":{"fulfillmentOrderAcceptFulfillmentRequest":{"userErrors":[],"fulfillmentOrder":{"id":"gid://shopify/FulfillmentOrder/1"}}}}`))
+		case strings.Contains(string(b), "fulfillmentOrderRejectCancellationRequest"):
+			w.Write([]byte(`{"data":{"fulfillmentOrderRejectCancellationRequest":{"userErrors":[{"field":["id"],"message":"Not found"}],"fulfillmentOrder":null}}}`))
+		case strings.Contains(string(b), "fulfillmentCreateV2"):
+			w.Write([]byte(`{"data":{"fulfillmentCreateV2":{"userErrors":[],"fulfillment":{"id":"gid://shopify/Fulfillment/3"}}}}`))
+		}
+	}))
+
+	orders, err := c.AssignedFulfillmentOrders(FulfillmentRequested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].OrderName != "#1001" || len(orders[0].LineItems) != 1 ||
+		orders[0].LineItems[0].Sku != "A" || orders[0].LineItems[0].RemainingQuantity != 3 {
+		t.Errorf("fulfillment orders are not correct: %+v", orders)
+	}
+	if !strings.Contains(queries[0], `"status":"FULFILLMENT_REQUESTED"`) {
+		t.Error("assignment status should be sent")
+	}
+
+	if err := c.AcceptFulfillmentRequest("gid://shopify/FulfillmentOrder/1", "OK"); err != nil {
+		t.Error(err)
+	}
+	if err := c.RejectCancellationRequest("gid://shopify/FulfillmentOrder/9", ""); err == nil {
+		t.Error("user errors should be returned")
+	}
+
+	id, err := c.CreateFulfillment("gid://shopify/FulfillmentOrder/1", TrackingInfo{Company: "UPS", Number: "1Z"}, true)
+	if err != nil || id != "gid://shopify/Fulfillment/3" {
+		t.Errorf("fulfillment should be created: %v", err)
+	}
+	if !strings.Contains(queries[len(queries)-1], `"trackingInfo":{"company":"UPS","number":"1Z"}`) {
+		t.Errorf("tracking info should be sent: %s", queries[len(queries)-1])
+	}
+}
@@ -0,0 +1,226 @@
+// Package graphql contains a tokenizer of GraphQL documents, used to handle
+// bodies of operations of shopify.Multi.
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	EOF         Kind = iota
+	Punctuator       // ! $ & ( ) ... : = @ [ ] { | }
+	Name             // field names, types, keywords, enum values
+	Int              // 10, -1
+	Float            // 1.5, 1e3
+	String           // "a", with quotes
+	BlockString      // """a""", with quotes
+)
+
+type (
+	// Kind of a token.
+	Kind int
+
+	// Token of a GraphQL document. Whitespace, commas and comments are
+	// ignored.
+	Token struct {
+		Kind  Kind
+		Value string // source text of the token
+		Pos   int    // byte offset of the token in the source
+	}
+
+	// Error of a malformed document.
+	SyntaxError struct {
+		Message string
+		Pos     int
+	}
+)
+
+// Lex splits the source into tokens, ending with a token of EOF.
+func Lex(src string) (tokens []Token, err error) {
+	pos := 0
+	for {
+		pos = skipIgnored(src, pos)
+		if pos >= len(src) {
+			tokens = append(tokens, Token{EOF, "", pos})
+			return
+		}
+		var token Token
+		if token, err = lexToken(src, pos); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		pos += len(token.Value)
+	}
+}
+
+// End returns the byte offset after the token.
+func (t Token) End() int {
+	return t.Pos + len(t.Value)
+}
+
+// Is reports whether the token is the punctuator or name.
+func (t Token) Is(value string) bool {
+	return (t.Kind == Punctuator || t.Kind == Name) && t.Value == value
+}
+
+func (t Token) String() string {
+	if t.Kind == EOF {
+		return "end of document"
+	}
+	return fmt.Sprintf("%q", t.Value)
+}
+
+func (k Kind) String() string {
+	switch k {
+	case EOF:
+		return "EOF"
+	case Punctuator:
+		return "Punctuator"
+	case Name:
+		return "Name"
+	case Int:
+		return "Int"
+	case Float:
+		return "Float"
+	case String:
+		return "String"
+	case BlockString:
+		return "BlockString"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("graphql: %s at position %d", e.Message, e.Pos)
+}
+
+func lexToken(src string, pos int) (Token, error) {
+	c := src[pos]
+	switch {
+	case strings.IndexByte("!$&():=@[]{|}", c) > -1:
+		return Token{Punctuator, src[pos : pos+1], pos}, nil
+	case c == '.':
+		if strings.HasPrefix(src[pos:], "...") {
+			return Token{Punctuator, "...", pos}, nil
+		}
+		return Token{}, &SyntaxError{"unexpected \".\"", pos}
+	case isNameStart(c):
+		end := pos + 1
+		for end < len(src) && (isNameStart(src[end]) || isDigit(src[end])) {
+			end++
+		}
+		return Token{Name, src[pos:end], pos}, nil
+	case c == '-' || isDigit(c):
+		return lexNumber(src, pos)
+	case strings.HasPrefix(src[pos:], `"""`):
+		for end := pos + 3; end < len(src); end++ {
+			if src[end] == '\\' && strings.HasPrefix(src[end:], `\"""`) {
+				end += 3
+			} else if strings.HasPrefix(src[end:], `"""`) {
+				return Token{BlockString, src[pos : end+3], pos}, nil
+			}
+		}
+		return Token{}, &SyntaxError{"unterminated block string", pos}
+	case c == '"':
+		for end := pos + 1; end < len(src) && src[end] != '\n'; end++ {
+			if src[end] == '\\' {
+				end++
+			} else if src[end] == '"' {
+				return Token{String, src[pos : end+1], pos}, nil
+			}
+		}
+		return Token{}, &SyntaxError{"unterminated string", pos}
+	}
+	return Token{}, &SyntaxError{fmt.Sprintf("unexpected %q", c), pos}
+}
+
+func lexNumber(src string, pos int) (Token, error) {
+	end := pos
+	if src[end] == '-' {
+		end++
+	}
+	digits := func() bool {
+		start := end
+		for end < len(src) && isDigit(src[end]) {
+			end++
+		}
+		return end > start
+	}
+	if !digits() {
+		return Token{}, &SyntaxError{"invalid number", pos}
+	}
+	kind := Int
+	if end < len(src) && src[end] == '.' {
+		end++
+		if !digits() {
+			return Token{}, &SyntaxError{"invalid number", pos}
+		}
+		kind = Float
+	}
+	if end < len(src) && (src[end] == 'e' || src[end] == 'E') {
+		end++
+		if end < len(src) && (src[end] == '+' || src[end] == '-') {
+			end++
+		}
+		if !digits() {
+			return Token{}, &SyntaxError{"invalid number", pos}
+		}
+		kind = Float
+	}
+	if end < len(src) && (isNameStart(src[end]) || src[end] == '.') {
+		return Token{}, &SyntaxError{"invalid number", pos}
+	}
+	return Token{kind, src[pos:end], pos}, nil
+}
+
+// skipIgnored skips whitespace, commas and comments.
+func skipIgnored(src string, pos int) int {
+	for pos < len(src) {
+		switch src[pos] {
+		case ' ', '\t', '\r', '\n', ',':
+			pos++
+		case '#':
+			for pos < len(src) && src[pos] != '\n' && src[pos] != '\r' {
+				pos++
+			}
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Minify removes ignored tokens like whitespace, commas and comments from
+// the source, keeping spaces only between names and numbers and between
+// strings, so that adjacent strings are not merged.
+func Minify(src string) (string, error) {
+	tokens, err := Lex(src)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && (isWord(tokens[i-1]) && isWord(t) || isString(tokens[i-1]) && isString(t)) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Value)
+	}
+	return b.String(), nil
+}
+
+func isWord(t Token) bool {
+	return t.Kind == Name || t.Kind == Int || t.Kind == Float
+}
+
+func isString(t Token) bool {
+	return t.Kind == String || t.Kind == BlockString
+}
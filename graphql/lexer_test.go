@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := Lex(`query ($ids: [ID!]!, $n: Int = -10) { # comment
+nodes(ids: $ids) { ... on Product @include(if: true) { title(x: 1.5e3, s: "a \" b", b: """x "" y""") } }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	var kinds []string
+	for _, token := range tokens {
+		values = append(values, token.Value)
+		kinds = append(kinds, token.Kind.String()[:1])
+	}
+	if strings.Join(values, " ") != `query ( $ ids : [ ID ! ] ! $ n : Int = -10 ) { nodes ( ids : $ ids ) { ... on Product @ include ( if : true ) { title ( x : 1.5e3 s : "a \" b" b : """x "" y""" ) } } } ` {
+		t.Error("values are not correct:", strings.Join(values, " "))
+	}
+	if strings.Join(kinds, "") != "NPPNPPNPPPPNPNPIPPNPNPPNPPPNNPNPNPNPPNPNPFNPSNPBPPPPE" {
+		t.Error("kinds are not correct:", strings.Join(kinds, ""))
+	}
+	if tokens[1].Pos != 6 || tokens[1].End() != 7 || !tokens[1].Is("(") {
+		t.Error("position is not correct")
+	}
+
+	for _, src := range []string{`"abc`, `"""abc`, `1.`, `1e`, `12abc`, `..`, `%`, "\"a\nb\""} {
+		if _, err := Lex(src); err == nil {
+			t.Errorf("%q should be invalid", src)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%q should return syntax error", src)
+		}
+	}
+}
+
+func TestMinify(t *testing.T) {
+	out, err := Minify(`query Q($ids: [ID!]!, $n: Int = 10) { # comment
+  nodes(ids: $ids) {
+    ... on Product @include(if: true) { title(s: "a  b", x: [1, 2]) }
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `query Q($ids:[ID!]!$n:Int=10){nodes(ids:$ids){...on Product@include(if:true){title(s:"a  b"x:[1 2])}}}` {
+		t.Error("minified document is not correct:", out)
+	}
+	if _, err := Parse(out); err != nil {
+		t.Error("minified document should be valid:", err)
+	}
+	for src, want := range map[string]string{
+		`{ a(ids: ["", "x"]) }`:   `{a(ids:["" "x"])}`,
+		`{ a(s: ["a" """b"""]) }`: `{a(s:["a" """b"""])}`,
+	} {
+		out, err := Minify(src)
+		if err != nil || out != want {
+			t.Errorf("adjacent strings should be separated: %s %v", out, err)
+		}
+		if _, err := Parse(out); err != nil {
+			t.Error("minified document should be valid:", err)
+		}
+	}
+	if _, err := Minify(`"abc`); err == nil {
+		t.Error("invalid document should return error")
+	}
+}
@@ -0,0 +1,447 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Document is a parsed GraphQL document.
+	Document struct {
+		Operations []*Operation
+		Fragments  []*Fragment
+	}
+
+	// Operation is a query, mutation or subscription.
+	Operation struct {
+		Type                string // query, mutation or subscription
+		Name                string // empty for anonymous operations
+		VariableDefinitions []*VariableDefinition
+		Directives          []*Directive
+		SelectionSet        []Selection
+
+		usage
+	}
+
+	// Fragment is a named fragment definition.
+	Fragment struct {
+		Name          string
+		TypeCondition string
+		Directives    []*Directive
+		SelectionSet  []Selection
+
+		usage
+	}
+
+	// VariableDefinition is a variable of an operation, like
+	// "$ids: [ID!]! = []".
+	VariableDefinition struct {
+		Name         string
+		Type         string // without whitespace, like "[ID!]!"
+		DefaultValue string // source text of the value
+		Directives   []*Directive
+	}
+
+	// Selection is a *Field, *FragmentSpread or *InlineFragment.
+	Selection interface {
+		selection()
+	}
+
+	Field struct {
+		Alias        string
+		Name         string
+		Arguments    []*Argument
+		Directives   []*Directive
+		SelectionSet []Selection
+	}
+
+	FragmentSpread struct {
+		Name       string
+		Directives []*Directive
+	}
+
+	InlineFragment struct {
+		TypeCondition string // empty if omitted
+		Directives    []*Directive
+		SelectionSet  []Selection
+	}
+
+	Directive struct {
+		Name      string
+		Arguments []*Argument
+	}
+
+	Argument struct {
+		Name  string
+		Value string // source text of the value, like "$id" or "[1, 2]"
+	}
+
+	// Variables and fragments used in an operation or a fragment, not
+	// including the ones used by its fragments.
+	usage struct {
+		variables []string
+		spreads   []string
+	}
+
+	parser struct {
+		src    string
+		tokens []Token
+		i      int
+		usage  *usage
+	}
+)
+
+func (*Field) selection()          {}
+func (*FragmentSpread) selection() {}
+func (*InlineFragment) selection() {}
+
+// Parse parses the operations and fragments of a GraphQL document.
+func Parse(src string) (*Document, error) {
+	tokens, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	doc := new(Document)
+	for p.peek().Kind != EOF {
+		t := p.peek()
+		switch {
+		case t.Is("{"), t.Is("query"), t.Is("mutation"), t.Is("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case t.Is("fragment"):
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			doc.Fragments = append(doc.Fragments, f)
+		default:
+			return nil, p.errorf(t, "expected operation or fragment, got %s", t)
+		}
+	}
+	if len(doc.Operations) == 0 && len(doc.Fragments) == 0 {
+		return nil, p.errorf(p.peek(), "empty document")
+	}
+	return doc, nil
+}
+
+// OperationName returns the name of the first operation of the document, or
+// an empty string if it is anonymous.
+func OperationName(src string) (string, error) {
+	doc, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	if len(doc.Operations) == 0 {
+		return "", nil
+	}
+	return doc.Operations[0].Name, nil
+}
+
+// Operation returns the operation of the name. If name is empty, the only
+// operation of the document is returned.
+func (doc *Document) Operation(name string) *Operation {
+	for _, op := range doc.Operations {
+		if op.Name == name || name == "" && len(doc.Operations) == 1 {
+			return op
+		}
+	}
+	return nil
+}
+
+// Fragment returns the fragment of the name.
+func (doc *Document) Fragment(name string) *Fragment {
+	for _, f := range doc.Fragments {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (p *parser) operation() (op *Operation, err error) {
+	op = &Operation{Type: "query"}
+	p.usage = &op.usage
+	if !p.peek().Is("{") {
+		op.Type = p.next().Value
+		if p.peek().Kind == Name {
+			op.Name = p.next().Value
+		}
+		if p.peek().Is("(") {
+			p.next()
+			for !p.peek().Is(")") {
+				v, err := p.variableDefinition()
+				if err != nil {
+					return nil, err
+				}
+				op.VariableDefinitions = append(op.VariableDefinitions, v)
+			}
+			if len(op.VariableDefinitions) == 0 {
+				return nil, p.errorf(p.peek(), "expected variable definition")
+			}
+			p.next()
+		}
+		if op.Directives, err = p.directives(); err != nil {
+			return
+		}
+	}
+	op.SelectionSet, err = p.selectionSet()
+	return
+}
+
+func (p *parser) fragment() (f *Fragment, err error) {
+	f = new(Fragment)
+	p.usage = &f.usage
+	p.next()
+	if f.Name, err = p.name(); err != nil {
+		return
+	}
+	if f.Name == "on" {
+		return nil, p.errorf(p.tokens[p.i-1], "fragment can not be named on")
+	}
+	if _, err = p.expect("on"); err != nil {
+		return
+	}
+	if f.TypeCondition, err = p.name(); err != nil {
+		return
+	}
+	if f.Directives, err = p.directives(); err != nil {
+		return
+	}
+	f.SelectionSet, err = p.selectionSet()
+	return
+}
+
+func (p *parser) variableDefinition() (v *VariableDefinition, err error) {
+	v = new(VariableDefinition)
+	if _, err = p.expect("$"); err != nil {
+		return
+	}
+	if v.Name, err = p.name(); err != nil {
+		return
+	}
+	if _, err = p.expect(":"); err != nil {
+		return
+	}
+	if v.Type, err = p.typ(); err != nil {
+		return
+	}
+	if p.peek().Is("=") {
+		p.next()
+		if v.DefaultValue, err = p.value(true); err != nil {
+			return
+		}
+	}
+	v.Directives, err = p.directives()
+	return
+}
+
+// typ parses a named type, a list type or a non-null type.
+func (p *parser) typ() (typ string, err error) {
+	if p.peek().Is("[") {
+		p.next()
+		if typ, err = p.typ(); err != nil {
+			return
+		}
+		if _, err = p.expect("]"); err != nil {
+			return
+		}
+		typ = "[" + typ + "]"
+	} else if typ, err = p.name(); err != nil {
+		return
+	}
+	if p.peek().Is("!") {
+		p.next()
+		typ += "!"
+	}
+	return
+}
+
+func (p *parser) selectionSet() (selections []Selection, err error) {
+	if _, err = p.expect("{"); err != nil {
+		return
+	}
+	for !p.peek().Is("}") {
+		var s Selection
+		if s, err = p.selection(); err != nil {
+			return
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf(p.peek(), "empty selection set")
+	}
+	p.next()
+	return
+}
+
+func (p *parser) selection() (Selection, error) {
+	if p.peek().Is("...") {
+		p.next()
+		if t := p.peek(); t.Kind == Name && t.Value != "on" {
+			p.next()
+			p.usage.spreads = append(p.usage.spreads, t.Value)
+			directives, err := p.directives()
+			return &FragmentSpread{t.Value, directives}, err
+		}
+		f := new(InlineFragment)
+		var err error
+		if p.peek().Is("on") {
+			p.next()
+			if f.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if f.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		f.SelectionSet, err = p.selectionSet()
+		return f, err
+	}
+	f := new(Field)
+	var err error
+	if f.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.peek().Is(":") {
+		p.next()
+		f.Alias = f.Name
+		if f.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Arguments, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if f.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek().Is("{") {
+		f.SelectionSet, err = p.selectionSet()
+	}
+	return f, err
+}
+
+func (p *parser) arguments() (args []*Argument, err error) {
+	if !p.peek().Is("(") {
+		return
+	}
+	p.next()
+	for !p.peek().Is(")") {
+		arg := new(Argument)
+		if arg.Name, err = p.name(); err != nil {
+			return
+		}
+		if _, err = p.expect(":"); err != nil {
+			return
+		}
+		if arg.Value, err = p.value(false); err != nil {
+			return
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return nil, p.errorf(p.peek(), "expected argument")
+	}
+	p.next()
+	return
+}
+
+func (p *parser) directives() (directives []*Directive, err error) {
+	for p.peek().Is("@") {
+		p.next()
+		d := new(Directive)
+		if d.Name, err = p.name(); err != nil {
+			return
+		}
+		if d.Arguments, err = p.arguments(); err != nil {
+			return
+		}
+		directives = append(directives, d)
+	}
+	return
+}
+
+// value parses a value and returns its source text. Variables are not
+// allowed in constant values, like default values of variables.
+func (p *parser) value(constant bool) (string, error) {
+	start := p.peek()
+	if err := p.skipValue(constant); err != nil {
+		return "", err
+	}
+	return p.src[start.Pos:p.tokens[p.i-1].End()], nil
+}
+
+func (p *parser) skipValue(constant bool) error {
+	t := p.next()
+	switch {
+	case t.Is("$") && !constant:
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		p.usage.variables = append(p.usage.variables, name)
+	case t.Is("["):
+		for !p.peek().Is("]") {
+			if err := p.skipValue(constant); err != nil {
+				return err
+			}
+		}
+		p.next()
+	case t.Is("{"):
+		for !p.peek().Is("}") {
+			if _, err := p.name(); err != nil {
+				return err
+			}
+			if _, err := p.expect(":"); err != nil {
+				return err
+			}
+			if err := p.skipValue(constant); err != nil {
+				return err
+			}
+		}
+		p.next()
+	case t.Kind == Name, t.Kind == Int, t.Kind == Float, t.Kind == String, t.Kind == BlockString:
+	default:
+		return p.errorf(t, "expected value, got %s", t)
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.Kind != Name {
+		return "", p.errorf(t, "expected name, got %s", t)
+	}
+	p.next()
+	return t.Value, nil
+}
+
+func (p *parser) expect(value string) (Token, error) {
+	t := p.peek()
+	if !t.Is(value) {
+		return t, p.errorf(t, "expected %q, got %s", value, t)
+	}
+	return p.next(), nil
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.i]
+}
+
+// next returns the current token and moves to the next one. The last token
+// (EOF) is never passed.
+func (p *parser) next() Token {
+	t := p.tokens[p.i]
+	if p.i < len(p.tokens)-1 {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t Token, format string, a ...interface{}) error {
+	return &SyntaxError{strings.TrimSpace(fmt.Sprintf(format, a...)), t.Pos}
+}
@@ -0,0 +1,95 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+fragment ProductFields on Product @foo { id title }
+query getProducts($ids: [ID!]!, $first: Int = 10 @bar) @baz {
+  items: nodes(ids: $ids) {
+    __typename
+    ... on Product { ...ProductFields variants(first: $first) { edges { node { id } } } }
+    ... @include(if: true) { id }
+  }
+}
+mutation { shopUpdate(input: {name: "x", tags: ["a", $tag]}) { id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 2 || len(doc.Fragments) != 1 {
+		t.Fatal("number of definitions is not correct")
+	}
+	f := doc.Fragment("ProductFields")
+	if f == nil || f.TypeCondition != "Product" || len(f.Directives) != 1 || len(f.SelectionSet) != 2 {
+		t.Error("fragment is not correct")
+	}
+	op := doc.Operation("getProducts")
+	if op == nil || op.Type != "query" || len(op.Directives) != 1 || op.Directives[0].Name != "baz" {
+		t.Fatal("operation is not correct")
+	}
+	if len(op.VariableDefinitions) != 2 {
+		t.Fatal("variables are not correct")
+	}
+	if v := op.VariableDefinitions[0]; v.Name != "ids" || v.Type != "[ID!]!" || v.DefaultValue != "" {
+		t.Error("variable ids is not correct:", v)
+	}
+	if v := op.VariableDefinitions[1]; v.Name != "first" || v.Type != "Int" || v.DefaultValue != "10" || len(v.Directives) != 1 {
+		t.Error("variable first is not correct:", v)
+	}
+	field := op.SelectionSet[0].(*Field)
+	if field.Alias != "items" || field.Name != "nodes" || len(field.Arguments) != 1 ||
+		field.Arguments[0].Value != "$ids" || len(field.SelectionSet) != 3 {
+		t.Error("field is not correct")
+	}
+	inline := field.SelectionSet[1].(*InlineFragment)
+	if inline.TypeCondition != "Product" || inline.SelectionSet[0].(*FragmentSpread).Name != "ProductFields" {
+		t.Error("inline fragment is not correct")
+	}
+	if inline := field.SelectionSet[2].(*InlineFragment); inline.TypeCondition != "" || len(inline.Directives) != 1 {
+		t.Error("inline fragment without type condition is not correct")
+	}
+	if len(op.variables) != 2 || len(op.spreads) != 1 {
+		t.Error("usage is not correct:", op.usage)
+	}
+	mutation := doc.Operations[1]
+	if mutation.Type != "mutation" || mutation.Name != "" ||
+		mutation.SelectionSet[0].(*Field).Arguments[0].Value != `{name: "x", tags: ["a", $tag]}` {
+		t.Error("mutation is not correct")
+	}
+	if doc.Operation("") != mutation || doc.Operation("foo") != nil {
+		t.Error("operation by name is not correct")
+	}
+
+	if name, err := OperationName(`{ shop { name } }`); err != nil || name != "" {
+		t.Error("anonymous operation should have empty name")
+	}
+	if name, err := OperationName(`mutation foo { a }`); err != nil || name != "foo" {
+		t.Error("operation name is not correct")
+	}
+
+	for _, src := range []string{
+		``,
+		`{}`,
+		`{ a`,
+		`query ()`,
+		`query ($a: Int = $b) { a }`,
+		`query ($a Int) { a }`,
+		`query ($a: [Int) { a }`,
+		`{ a() }`,
+		`{ a(b: ) }`,
+		`{ a: }`,
+		`{ ... on { a } }`,
+		`fragment on on A { a }`,
+		`fragment A B { a }`,
+		`type A { a }`,
+		`{ a } }`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("%q should be invalid", src)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%q should return syntax error", src)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package graphql
+
+import (
+	"strings"
+)
+
+type printer struct {
+	strings.Builder
+	indent int
+}
+
+// String prints the document with two-space indentation, operations first.
+// Values are printed as they are in the source.
+func (doc *Document) String() string {
+	p := new(printer)
+	for i, op := range doc.Operations {
+		if i > 0 {
+			p.WriteString("\n")
+		}
+		p.operation(op)
+	}
+	for i, f := range doc.Fragments {
+		if i > 0 || len(doc.Operations) > 0 {
+			p.WriteString("\n")
+		}
+		p.fragment(f)
+	}
+	return p.String()
+}
+
+func (p *printer) operation(op *Operation) {
+	p.WriteString(op.Type)
+	if op.Name != "" {
+		p.WriteString(" " + op.Name)
+	}
+	if len(op.VariableDefinitions) > 0 {
+		p.WriteString("(")
+		for i, v := range op.VariableDefinitions {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.WriteString("$" + v.Name + ": " + v.Type)
+			if v.DefaultValue != "" {
+				p.WriteString(" = " + v.DefaultValue)
+			}
+			p.directives(v.Directives)
+		}
+		p.WriteString(")")
+	}
+	p.directives(op.Directives)
+	p.WriteString(" ")
+	p.selectionSet(op.SelectionSet)
+	p.WriteString("\n")
+}
+
+func (p *printer) fragment(f *Fragment) {
+	p.WriteString("fragment " + f.Name + " on " + f.TypeCondition)
+	p.directives(f.Directives)
+	p.WriteString(" ")
+	p.selectionSet(f.SelectionSet)
+	p.WriteString("\n")
+}
+
+func (p *printer) selectionSet(selections []Selection) {
+	p.WriteString("{\n")
+	p.indent++
+	for _, selection := range selections {
+		p.WriteString(strings.Repeat("  ", p.indent))
+		switch s := selection.(type) {
+		case *Field:
+			if s.Alias != "" {
+				p.WriteString(s.Alias + ": ")
+			}
+			p.WriteString(s.Name)
+			p.arguments(s.Arguments)
+			p.directives(s.Directives)
+			if len(s.SelectionSet) > 0 {
+				p.WriteString(" ")
+				p.selectionSet(s.SelectionSet)
+			}
+		case *FragmentSpread:
+			p.WriteString("..." + s.Name)
+			p.directives(s.Directives)
+		case *InlineFragment:
+			p.WriteString("...")
+			if s.TypeCondition != "" {
+				p.WriteString(" on " + s.TypeCondition)
+			}
+			p.directives(s.Directives)
+			p.WriteString(" ")
+			p.selectionSet(s.SelectionSet)
+		}
+		p.WriteString("\n")
+	}
+	p.indent--
+	p.WriteString(strings.Repeat("  ", p.indent) + "}")
+}
+
+func (p *printer) arguments(args []*Argument) {
+	if len(args) == 0 {
+		return
+	}
+	p.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+		p.WriteString(arg.Name + ": " + arg.Value)
+	}
+	p.WriteString(")")
+}
+
+func (p *printer) directives(directives []*Directive) {
+	for _, d := range directives {
+		p.WriteString(" @" + d.Name)
+		p.arguments(d.Arguments)
+	}
+}
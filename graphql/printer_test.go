@@ -0,0 +1,50 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestPrint(t *testing.T) {
+	const src = `fragment F on Product @a { id }
+query getProducts($first: Int! = 10 @b, $q: String) @c {
+  items: products(first: $first, query: $q) { edges { node { ...F @d ... on Product { title } ... @include(if: true) { handle } } } }
+}
+mutation { shopUpdate(input: {name: "x"}) { id } }`
+	doc, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `query getProducts($first: Int! = 10 @b, $q: String) @c {
+  items: products(first: $first, query: $q) {
+    edges {
+      node {
+        ...F @d
+        ... on Product {
+          title
+        }
+        ... @include(if: true) {
+          handle
+        }
+      }
+    }
+  }
+}
+
+mutation {
+  shopUpdate(input: {name: "x"}) {
+    id
+  }
+}
+
+fragment F on Product @a {
+  id
+}
+`
+	if out := doc.String(); out != expected {
+		t.Error("printed document is not correct:", out)
+	}
+	again, err := Parse(doc.String())
+	if err != nil || again.String() != expected {
+		t.Error("printed document should be parsed to the same document:", err)
+	}
+}
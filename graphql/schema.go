@@ -0,0 +1,317 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// IntrospectionQuery gets the schema of a GraphQL API, which can be decoded
+// into Schema with ReadSchema.
+const IntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    types {
+      kind
+      name
+      description
+      fields(includeDeprecated: true) {
+        name
+        description
+        args { ...InputValue }
+        type { ...TypeRef }
+        isDeprecated
+        deprecationReason
+      }
+      inputFields { ...InputValue }
+      interfaces { ...TypeRef }
+      enumValues(includeDeprecated: true) {
+        name
+        description
+        isDeprecated
+        deprecationReason
+      }
+      possibleTypes { ...TypeRef }
+    }
+  }
+}
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } }
+}`
+
+// Kinds of types.
+const (
+	KindScalar      = "SCALAR"
+	KindObject      = "OBJECT"
+	KindInterface   = "INTERFACE"
+	KindUnion       = "UNION"
+	KindEnum        = "ENUM"
+	KindInputObject = "INPUT_OBJECT"
+	KindList        = "LIST"
+	KindNonNull     = "NON_NULL"
+)
+
+type (
+	// Schema is the result of IntrospectionQuery.
+	Schema struct {
+		QueryType    *TypeName `json:"queryType"`
+		MutationType *TypeName `json:"mutationType"`
+		Types        []*Type   `json:"types"`
+
+		types map[string]*Type
+	}
+
+	TypeName struct {
+		Name string `json:"name"`
+	}
+
+	// Type is a named type of the schema.
+	Type struct {
+		Kind          string             `json:"kind"`
+		Name          string             `json:"name"`
+		Description   string             `json:"description,omitempty"`
+		Fields        []*FieldDefinition `json:"fields,omitempty"`
+		InputFields   []*InputValue      `json:"inputFields,omitempty"`
+		Interfaces    []*TypeRef         `json:"interfaces,omitempty"`
+		EnumValues    []*EnumValue       `json:"enumValues,omitempty"`
+		PossibleTypes []*TypeRef         `json:"possibleTypes,omitempty"`
+	}
+
+	// FieldDefinition is a field of an object or an interface.
+	FieldDefinition struct {
+		Name              string        `json:"name"`
+		Description       string        `json:"description,omitempty"`
+		Args              []*InputValue `json:"args"`
+		Type              *TypeRef      `json:"type"`
+		IsDeprecated      bool          `json:"isDeprecated,omitempty"`
+		DeprecationReason string        `json:"deprecationReason,omitempty"`
+	}
+
+	// InputValue is an argument of a field or a field of an input object.
+	InputValue struct {
+		Name         string   `json:"name"`
+		Description  string   `json:"description,omitempty"`
+		Type         *TypeRef `json:"type"`
+		DefaultValue *string  `json:"defaultValue,omitempty"`
+	}
+
+	EnumValue struct {
+		Name              string `json:"name"`
+		Description       string `json:"description,omitempty"`
+		IsDeprecated      bool   `json:"isDeprecated,omitempty"`
+		DeprecationReason string `json:"deprecationReason,omitempty"`
+	}
+
+	// TypeRef is a named type, or a list or non-null type of OfType.
+	TypeRef struct {
+		Kind   string   `json:"kind"`
+		Name   string   `json:"name,omitempty"`
+		OfType *TypeRef `json:"ofType,omitempty"`
+	}
+
+	schemaFile struct {
+		Data *struct {
+			Schema *Schema `json:"__schema"`
+		} `json:"data,omitempty"`
+		Schema *Schema `json:"__schema"`
+	}
+)
+
+// ReadSchema decodes the schema from JSON of the result of
+// IntrospectionQuery, with or without the "data" key.
+func ReadSchema(r io.Reader) (*Schema, error) {
+	var file schemaFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	schema := file.Schema
+	if schema == nil && file.Data != nil {
+		schema = file.Data.Schema
+	}
+	if schema == nil {
+		return nil, errors.New("graphql: no __schema in file")
+	}
+	return schema, nil
+}
+
+// ReadSchemaFile reads the schema from the file, see ReadSchema.
+func ReadSchemaFile(name string) (*Schema, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSchema(f)
+}
+
+// Write encodes the schema into indented JSON which can be read by
+// ReadSchema.
+func (s *Schema) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schemaFile{Schema: s})
+}
+
+// WriteFile writes the schema to the file, see Write.
+func (s *Schema) WriteFile(name string) error {
+	var b bytes.Buffer
+	if err := s.Write(&b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b.Bytes(), 0644)
+}
+
+// UnmarshalJSON decodes the schema and indexes its types.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	type schema Schema
+	if err := json.Unmarshal(b, (*schema)(s)); err != nil {
+		return err
+	}
+	s.index()
+	return nil
+}
+
+func (s *Schema) index() {
+	s.types = map[string]*Type{}
+	for _, t := range s.Types {
+		s.types[t.Name] = t
+	}
+}
+
+// Type returns the named type, or nil if not found.
+func (s *Schema) Type(name string) *Type {
+	if s.types != nil {
+		return s.types[name]
+	}
+	for _, t := range s.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// RootType returns the type of the operation type, like "query" or
+// "mutation".
+func (s *Schema) RootType(operationType string) *Type {
+	var name *TypeName
+	switch operationType {
+	case "query":
+		name = s.QueryType
+	case "mutation":
+		name = s.MutationType
+	}
+	if name == nil {
+		return nil
+	}
+	return s.Type(name.Name)
+}
+
+// Field returns the field of the object or interface, or nil if not found.
+func (t *Type) Field(name string) *FieldDefinition {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// InputField returns the field of the input object, or nil if not found.
+func (t *Type) InputField(name string) *InputValue {
+	return findInputValue(t.InputFields, name)
+}
+
+// EnumValue returns the value of the enum, or nil if not found.
+func (t *Type) EnumValue(name string) *EnumValue {
+	for _, v := range t.EnumValues {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// IsLeaf returns true for scalars and enums, which have no selection set.
+func (t *Type) IsLeaf() bool {
+	return t.Kind == KindScalar || t.Kind == KindEnum
+}
+
+// IsInput returns true for types which can be used for variables.
+func (t *Type) IsInput() bool {
+	return t.IsLeaf() || t.Kind == KindInputObject
+}
+
+// Arg returns the argument of the field, or nil if not found.
+func (f *FieldDefinition) Arg(name string) *InputValue {
+	return findInputValue(f.Args, name)
+}
+
+// NamedType returns the name of the innermost named type.
+func (t *TypeRef) NamedType() string {
+	for t.OfType != nil && (t.Kind == KindList || t.Kind == KindNonNull) {
+		t = t.OfType
+	}
+	return t.Name
+}
+
+// String returns the type in GraphQL syntax, like "[ID!]!".
+func (t *TypeRef) String() string {
+	switch t.Kind {
+	case KindNonNull:
+		return t.OfType.String() + "!"
+	case KindList:
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+// ParseTypeRef parses a type in GraphQL syntax, like "[ID!]!". Kinds of
+// named types are left empty.
+func ParseTypeRef(typ string) (*TypeRef, error) {
+	p := &parser{src: typ}
+	var err error
+	if p.tokens, err = Lex(typ); err != nil {
+		return nil, err
+	}
+	if typ, err = p.typ(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.Kind != EOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return parseTypeRef(typ), nil
+}
+
+// parseTypeRef converts a valid type like "[ID!]!" into TypeRef.
+func parseTypeRef(typ string) *TypeRef {
+	if strings.HasSuffix(typ, "!") {
+		return &TypeRef{Kind: KindNonNull, OfType: parseTypeRef(typ[:len(typ)-1])}
+	}
+	if strings.HasPrefix(typ, "[") {
+		return &TypeRef{Kind: KindList, OfType: parseTypeRef(typ[1 : len(typ)-1])}
+	}
+	return &TypeRef{Name: typ}
+}
+
+func findInputValue(values []*InputValue, name string) *InputValue {
+	for _, v := range values {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
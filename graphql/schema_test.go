@@ -0,0 +1,186 @@
+package graphql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func named(kind, name string) *TypeRef {
+	return &TypeRef{Kind: kind, Name: name}
+}
+
+func nonNull(t *TypeRef) *TypeRef {
+	return &TypeRef{Kind: KindNonNull, OfType: t}
+}
+
+func list(t *TypeRef) *TypeRef {
+	return &TypeRef{Kind: KindList, OfType: t}
+}
+
+func testSchema() *Schema {
+	id := named(KindScalar, "ID")
+	str := named(KindScalar, "String")
+	product := named(KindObject, "Product")
+	ten := "10"
+	return &Schema{
+		QueryType:    &TypeName{"QueryRoot"},
+		MutationType: &TypeName{"Mutation"},
+		Types: []*Type{
+			{Kind: KindScalar, Name: "ID"},
+			{Kind: KindScalar, Name: "Int"},
+			{Kind: KindScalar, Name: "String"},
+			{Kind: KindScalar, Name: "Boolean"},
+			{Kind: KindScalar, Name: "DateTime"},
+			{Kind: KindObject, Name: "QueryRoot", Fields: []*FieldDefinition{
+				{Name: "shop", Type: nonNull(named(KindObject, "Shop"))},
+				{Name: "products", Type: nonNull(named(KindObject, "ProductConnection")), Args: []*InputValue{
+					{Name: "first", Type: nonNull(named(KindScalar, "Int"))},
+					{Name: "query", Type: str},
+					{Name: "sortKey", Type: named(KindEnum, "ProductSortKeys")},
+				}},
+				{Name: "nodes", Type: nonNull(list(named(KindInterface, "Node"))), Args: []*InputValue{
+					{Name: "ids", Type: nonNull(list(nonNull(id)))},
+				}},
+			}},
+			{Kind: KindObject, Name: "Mutation", Fields: []*FieldDefinition{
+				{Name: "productUpdate", Type: named(KindObject, "ProductUpdatePayload"), Args: []*InputValue{
+					{Name: "input", Type: nonNull(named(KindInputObject, "ProductInput"))},
+				}},
+			}},
+			{Kind: KindObject, Name: "Shop", Fields: []*FieldDefinition{
+				{Name: "name", Type: nonNull(str)},
+				{Name: "updatedAt", Type: named(KindScalar, "DateTime")},
+			}},
+			{Kind: KindObject, Name: "ProductConnection", Fields: []*FieldDefinition{
+				{Name: "edges", Type: nonNull(list(nonNull(named(KindObject, "ProductEdge"))))},
+			}},
+			{Kind: KindObject, Name: "ProductEdge", Fields: []*FieldDefinition{
+				{Name: "node", Type: nonNull(product)},
+			}},
+			{Kind: KindObject, Name: "Product", Interfaces: []*TypeRef{named(KindInterface, "Node")}, Fields: []*FieldDefinition{
+				{Name: "id", Type: nonNull(id)},
+				{Name: "title", Type: nonNull(str)},
+				{Name: "bodyHtml", Type: str, IsDeprecated: true, DeprecationReason: "Use `descriptionHtml` instead."},
+				{Name: "images", Type: nonNull(list(str)), Args: []*InputValue{
+					{Name: "first", Type: named(KindScalar, "Int"), DefaultValue: &ten},
+				}},
+			}},
+			{Kind: KindInterface, Name: "Node", Fields: []*FieldDefinition{
+				{Name: "id", Type: nonNull(id)},
+			}, PossibleTypes: []*TypeRef{product}},
+			{Kind: KindEnum, Name: "ProductSortKeys", EnumValues: []*EnumValue{
+				{Name: "TITLE"},
+				{Name: "ID"},
+				{Name: "VENDOR", IsDeprecated: true},
+			}},
+			{Kind: KindInputObject, Name: "ProductInput", InputFields: []*InputValue{
+				{Name: "id", Type: nonNull(id)},
+				{Name: "title", Type: str},
+				{Name: "tags", Type: list(nonNull(str))},
+			}},
+			{Kind: KindObject, Name: "ProductUpdatePayload", Fields: []*FieldDefinition{
+				{Name: "product", Type: product},
+			}},
+		},
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSchema().Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := ReadSchema(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Type("Product") == nil || schema.RootType("mutation").Name != "Mutation" || schema.RootType("subscription") != nil {
+		t.Error("types are not correct")
+	}
+	if typ := schema.Type("QueryRoot").Field("nodes").Type; typ.String() != "[Node]!" || typ.NamedType() != "Node" {
+		t.Error("type ref is not correct:", typ)
+	}
+	if *schema.Type("Product").Field("images").Arg("first").DefaultValue != "10" {
+		t.Error("default value is not correct")
+	}
+
+	resp := `{"data":{"__schema":{"queryType":{"name":"Q"},"types":[{"kind":"OBJECT","name":"Q"}]}}}`
+	if schema, err := ReadSchema(strings.NewReader(resp)); err != nil || schema.RootType("query") == nil {
+		t.Error("schema in response should be read:", err)
+	}
+	if _, err := ReadSchema(strings.NewReader(`{}`)); err == nil {
+		t.Error("empty file should be invalid")
+	}
+
+	if typ, err := ParseTypeRef("[ ID! ]!"); err != nil || typ.String() != "[ID!]!" {
+		t.Error("parsed type is not correct:", typ, err)
+	}
+	for _, typ := range []string{"", "[ID", "ID!!", "[ID]]"} {
+		if _, err := ParseTypeRef(typ); err == nil {
+			t.Errorf("%q should be invalid", typ)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := testSchema()
+	for _, src := range []string{
+		`{ shop { name updatedAt __typename } }`,
+		`query ($n: Int!, $q: String) { products(first: $n, query: $q, sortKey: TITLE) { edges { node { id images } } } }`,
+		`query ($n: Int = 5) { products(first: $n) { edges { node { ...F } } } } fragment F on Product { title images(first: 1) }`,
+		`query ($ids: [ID!]!) { nodes(ids: $ids) { __typename id ... on Product { title } } }`,
+		`{ nodes(ids: "1") { id } }`,
+		`mutation { productUpdate(input: {id: 1, tags: "a"}) { product { id } } }`,
+		`mutation ($tags: [String!]) { productUpdate(input: {id: "1", title: null, tags: $tags}) { product { id } } }`,
+		`{ __schema { types { name } } }`,
+	} {
+		if err := schema.ValidateQuery(src); err != nil {
+			t.Errorf("%q should be valid: %s", src, err)
+		}
+	}
+
+	for src, message := range map[string]string{
+		`{ shop { title } }`:                                                           "graphql: anonymous query: shop: unknown field title on Shop",
+		`{ s: shop { name { x } } }`:                                                   "graphql: anonymous query: s.name: field name of type String! must not have a selection",
+		`{ shop }`:                                                                     "graphql: anonymous query: shop: field shop of type Shop! must have a selection",
+		`{ products { edges { node { id } } } }`:                                       "graphql: anonymous query: products: missing required argument first of field products",
+		`{ shop(id: 1) { name } }`:                                                     "graphql: anonymous query: shop: unknown argument id of field shop",
+		`{ products(first: "1") { edges { node { id } } } }`:                           "graphql: anonymous query: products(first): expected Int!, got \"1\"",
+		`{ products(first: null) { edges { node { id } } } }`:                          "graphql: anonymous query: products(first): null for non-null type Int!",
+		`{ products(first: 1, sortKey: NAME) { edges { node { id } } } }`:              "graphql: anonymous query: products(sortKey): unknown value NAME of enum ProductSortKeys",
+		`query q($n: Int) { products(first: $n) { edges { node { id } } } }`:           "graphql: query q: products(first): variable $n of type Int can not be used as Int!",
+		`query ($ids: [ID]) { nodes(ids: $ids) { id } }`:                               "graphql: anonymous query: nodes(ids): variable $ids of type [ID] can not be used as [ID!]!",
+		`query ($x: Foo) { shop { name(x: $x) } }`:                                     "graphql: anonymous query: unknown type Foo of variable $x, graphql: anonymous query: shop.name: unknown argument x of field name",
+		`query ($x: Shop) { products(first: 1, query: $x) { edges { node { id } } } }`: "graphql: anonymous query: type Shop of variable $x is not an input type, graphql: anonymous query: products(query): variable $x of type Shop can not be used as String",
+		`{ nodes(ids: []) { title } }`:                                                 "graphql: anonymous query: nodes: unknown field title on Node",
+		`{ nodes(ids: []) { ... on Foo { id } } }`:                                     "graphql: anonymous query: nodes: unknown type Foo",
+		`mutation { productUpdate(input: {title: "x", foo: 1}) { product { id } } }`:   "graphql: anonymous mutation: productUpdate(input): unknown field foo of ProductInput, graphql: anonymous mutation: productUpdate(input): missing required field id of ProductInput",
+		`mutation { productUpdate(input: [1]) { product { id } } }`:                    "graphql: anonymous mutation: productUpdate(input): expected ProductInput!, got [",
+		`mutation { productUpdate(input: {id: "1", tags: [1]}) { product { id } } }`:   "graphql: anonymous mutation: productUpdate(input).tags: expected String!, got 1",
+		`subscription { shop { name } }`:                                               "graphql: anonymous subscription: schema has no subscription type",
+		`fragment F on Nope { id }`:                                                    "graphql: fragment F: unknown type Nope",
+		`fragment F on Shop { nope ...G } fragment G on Shop { name { x } }`:           "graphql: fragment F: unknown field nope on Shop, graphql: fragment F: name: field name of type String! must not have a selection",
+		`fragment F on Shop { name } fragment G on Product { nope }`:                   "graphql: fragment G: unknown field nope on Product",
+	} {
+		err := schema.ValidateQuery(src)
+		if _, ok := err.(SchemaErrors); !ok {
+			t.Errorf("%q should return schema errors: %v", src, err)
+			continue
+		}
+		if err.Error() != message {
+			t.Errorf("%q has wrong error: %s", src, err)
+		}
+	}
+
+	doc, _ := ParseAndValidate(`{ products(first: 1, sortKey: VENDOR) { edges { node { bodyHtml } } } }`)
+	if err := schema.Validate(doc); err != nil {
+		t.Error("deprecations should not be errors:", err)
+	}
+	errs := schema.Check(doc)
+	if len(errs) != 2 || !errs[0].Deprecated || !errs[1].Deprecated ||
+		errs[0].Error() != "graphql: anonymous query: products(sortKey): value VENDOR of enum ProductSortKeys is deprecated" ||
+		errs[1].Error() != "graphql: anonymous query: products.edges.node.bodyHtml: field bodyHtml on Product is deprecated: Use `descriptionHtml` instead." {
+		t.Error("deprecations are not correct:", errs)
+	}
+}
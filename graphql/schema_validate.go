@@ -0,0 +1,383 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Error of a document which does not match the schema.
+	SchemaError struct {
+		Operation  string // like "query getProducts" or "fragment F"
+		Path       string // response path of the field, like "products.edges"
+		Message    string
+		Deprecated bool // the field or enum value is deprecated
+	}
+
+	SchemaErrors []*SchemaError
+
+	schemaValidator struct {
+		schema    *Schema
+		doc       *Document
+		scope     string // operation or fragment being checked
+		variables map[string]*VariableDefinition
+		visited   map[string]bool // fragments checked in the operation
+		checked   map[string]bool // fragments checked in the document
+		errs      SchemaErrors
+	}
+)
+
+// ValidateQuery parses and validates the document, then validates it against
+// the schema, see Validate.
+func (s *Schema) ValidateQuery(src string) error {
+	doc, err := ParseAndValidate(src)
+	if err != nil {
+		return err
+	}
+	return s.Validate(doc)
+}
+
+// Validate returns SchemaErrors if the document has unknown types, fields,
+// arguments or enum values, missing required arguments or input fields,
+// values or variables of wrong types, or selection sets missing on objects
+// or present on scalars. Deprecations are not errors, see Check.
+func (s *Schema) Validate(doc *Document) error {
+	var errs SchemaErrors
+	for _, err := range s.Check(doc) {
+		if !err.Deprecated {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Check returns all errors of the document found by Validate, plus uses of
+// deprecated fields and enum values. Fragments not spread in any operation
+// are checked on their own. The document should be validated by
+// Document.Validate first.
+func (s *Schema) Check(doc *Document) SchemaErrors {
+	v := &schemaValidator{schema: s, doc: doc, checked: map[string]bool{}}
+	for _, op := range doc.Operations {
+		v.scope = op.String()
+		v.variables = map[string]*VariableDefinition{}
+		v.visited = map[string]bool{}
+		for _, d := range op.VariableDefinitions {
+			v.variables[d.Name] = d
+			name := parseTypeRef(d.Type).NamedType()
+			if t := s.Type(name); t == nil {
+				v.errorf("", "unknown type %s of variable $%s", name, d.Name)
+			} else if !t.IsInput() {
+				v.errorf("", "type %s of variable $%s is not an input type", name, d.Name)
+			} else if d.DefaultValue != "" {
+				v.value("$"+d.Name, parseTypeRef(d.Type), d.DefaultValue)
+			}
+		}
+		root := s.RootType(op.Type)
+		if root == nil {
+			v.errorf("", "schema has no %s type", op.Type)
+			continue
+		}
+		v.selectionSet("", root, op.SelectionSet)
+	}
+	for _, f := range doc.Fragments {
+		if v.checked[f.Name] {
+			continue
+		}
+		v.scope = "fragment " + f.Name
+		v.variables = map[string]*VariableDefinition{}
+		v.visited = map[string]bool{}
+		v.selectionSet("", nil, []Selection{&FragmentSpread{Name: f.Name}})
+	}
+	return v.errs
+}
+
+func (v *schemaValidator) selectionSet(path string, parent *Type, selections []Selection) {
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *Field:
+			v.field(path, parent, s)
+		case *InlineFragment:
+			t := parent
+			if s.TypeCondition != "" {
+				if t = v.typeCondition(path, s.TypeCondition); t == nil {
+					continue
+				}
+			}
+			v.selectionSet(path, t, s.SelectionSet)
+		case *FragmentSpread:
+			f := v.doc.Fragment(s.Name)
+			if f == nil || v.visited[s.Name] {
+				continue
+			}
+			v.visited[s.Name] = true
+			v.checked[s.Name] = true
+			if t := v.typeCondition(path, f.TypeCondition); t != nil {
+				v.selectionSet(path, t, f.SelectionSet)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) typeCondition(path, name string) *Type {
+	t := v.schema.Type(name)
+	if t == nil {
+		v.errorf(path, "unknown type %s", name)
+		return nil
+	}
+	if t.Kind != KindObject && t.Kind != KindInterface && t.Kind != KindUnion {
+		v.errorf(path, "fragment can not be on %s type %s", strings.ToLower(t.Kind), name)
+		return nil
+	}
+	return t
+}
+
+func (v *schemaValidator) field(path string, parent *Type, f *Field) {
+	responseName := f.Name
+	if f.Alias != "" {
+		responseName = f.Alias
+	}
+	if path != "" {
+		responseName = path + "." + responseName
+	}
+	if f.Name == "__typename" {
+		if len(f.SelectionSet) > 0 {
+			v.errorf(responseName, "field __typename must not have a selection")
+		}
+		return
+	}
+	if (f.Name == "__schema" || f.Name == "__type") && parent == v.schema.RootType("query") {
+		return // introspection
+	}
+	def := parent.Field(f.Name)
+	if def == nil {
+		v.errorf(path, "unknown field %s on %s", f.Name, parent.Name)
+		return
+	}
+	path = responseName
+	if def.IsDeprecated {
+		v.deprecated(path, "field %s on %s is deprecated: %s", f.Name, parent.Name, def.DeprecationReason)
+	}
+	v.arguments(path, "field "+f.Name, def.Args, f.Arguments)
+	t := v.schema.Type(def.Type.NamedType())
+	if t == nil {
+		v.errorf(path, "unknown type %s", def.Type.NamedType())
+		return
+	}
+	if t.IsLeaf() && len(f.SelectionSet) > 0 {
+		v.errorf(path, "field %s of type %s must not have a selection", f.Name, def.Type)
+	} else if !t.IsLeaf() && len(f.SelectionSet) == 0 {
+		v.errorf(path, "field %s of type %s must have a selection", f.Name, def.Type)
+	} else {
+		v.selectionSet(path, t, f.SelectionSet)
+	}
+}
+
+func (v *schemaValidator) arguments(path, of string, defs []*InputValue, args []*Argument) {
+	provided := map[string]bool{}
+	for _, arg := range args {
+		def := findInputValue(defs, arg.Name)
+		if def == nil {
+			v.errorf(path, "unknown argument %s of %s", arg.Name, of)
+			continue
+		}
+		provided[arg.Name] = true
+		v.value(path+"("+arg.Name+")", def.Type, arg.Value)
+	}
+	for _, def := range defs {
+		if def.Type.Kind == KindNonNull && def.DefaultValue == nil && !provided[def.Name] {
+			v.errorf(path, "missing required argument %s of %s", def.Name, of)
+		}
+	}
+}
+
+// value checks the source text of a value, which is already parsed.
+func (v *schemaValidator) value(path string, typ *TypeRef, src string) {
+	tokens, err := Lex(src)
+	if err != nil {
+		v.errorf(path, "%s", err)
+		return
+	}
+	v.checkValue(path, typ, tokens)
+}
+
+// checkValue checks the value at the start of the tokens and returns the
+// tokens after it.
+func (v *schemaValidator) checkValue(path string, typ *TypeRef, tokens []Token) []Token {
+	t := tokens[0]
+	if t.Is("$") {
+		if d := v.variables[tokens[1].Value]; d != nil && !isVariableAllowed(parseTypeRef(d.Type), d.DefaultValue != "", typ) {
+			v.errorf(path, "variable $%s of type %s can not be used as %s", d.Name, d.Type, typ)
+		}
+		return tokens[2:]
+	}
+	if t.Is("null") {
+		if typ.Kind == KindNonNull {
+			v.errorf(path, "null for non-null type %s", typ)
+		}
+		return tokens[1:]
+	}
+	nullable := typ
+	if typ.Kind == KindNonNull {
+		nullable = typ.OfType
+	}
+	if nullable.Kind == KindList {
+		if !t.Is("[") {
+			return v.checkValue(path, nullable.OfType, tokens) // coerced into a list
+		}
+		for tokens = tokens[1:]; !tokens[0].Is("]"); {
+			tokens = v.checkValue(path, nullable.OfType, tokens)
+		}
+		return tokens[1:]
+	}
+	named := v.schema.Type(nullable.Name)
+	if named == nil {
+		return skipValueTokens(tokens)
+	}
+	if t.Is("[") || t.Is("{") && named.Kind != KindInputObject {
+		if named.Kind != KindScalar || isBuiltinScalar(named.Name) {
+			v.errorf(path, "expected %s, got %s", typ, t.Value)
+		}
+		return skipValueTokens(tokens)
+	}
+	switch named.Kind {
+	case KindInputObject:
+		if !t.Is("{") {
+			v.errorf(path, "expected %s, got %s", typ, t.Value)
+			return tokens[1:]
+		}
+		provided := map[string]bool{}
+		for tokens = tokens[1:]; !tokens[0].Is("}"); {
+			name := tokens[0].Value
+			tokens = tokens[2:] // name and colon
+			def := named.InputField(name)
+			if def == nil {
+				v.errorf(path, "unknown field %s of %s", name, named.Name)
+				tokens = skipValueTokens(tokens)
+				continue
+			}
+			provided[name] = true
+			tokens = v.checkValue(path+"."+name, def.Type, tokens)
+		}
+		for _, def := range named.InputFields {
+			if def.Type.Kind == KindNonNull && def.DefaultValue == nil && !provided[def.Name] {
+				v.errorf(path, "missing required field %s of %s", def.Name, named.Name)
+			}
+		}
+		return tokens[1:]
+	case KindEnum:
+		if t.Kind != Name || t.Is("true") || t.Is("false") {
+			v.errorf(path, "expected %s, got %s", typ, t.Value)
+		} else if e := named.EnumValue(t.Value); e == nil {
+			v.errorf(path, "unknown value %s of enum %s", t.Value, named.Name)
+		} else if e.IsDeprecated {
+			v.deprecated(path, "value %s of enum %s is deprecated: %s", t.Value, named.Name, e.DeprecationReason)
+		}
+	case KindScalar:
+		if !isScalarLiteral(named.Name, t) {
+			v.errorf(path, "expected %s, got %s", typ, t.Value)
+		}
+	default:
+		v.errorf(path, "%s is not an input type", named.Name)
+	}
+	return tokens[1:]
+}
+
+func (v *schemaValidator) errorf(path, format string, a ...interface{}) {
+	v.errs = append(v.errs, &SchemaError{v.scope, path, fmt.Sprintf(format, a...), false})
+}
+
+func (v *schemaValidator) deprecated(path, format string, a ...interface{}) {
+	message := strings.TrimSuffix(fmt.Sprintf(format, a...), ": ")
+	v.errs = append(v.errs, &SchemaError{v.scope, path, message, true})
+}
+
+// isVariableAllowed returns true if a variable of the type can be used at a
+// location of the type. Nullable variables with default values can be used
+// for non-null types.
+func isVariableAllowed(variable *TypeRef, hasDefault bool, location *TypeRef) bool {
+	if location.Kind == KindNonNull && variable.Kind != KindNonNull {
+		if !hasDefault {
+			return false
+		}
+		location = location.OfType
+	}
+	return isTypeSubtype(variable, location)
+}
+
+func isTypeSubtype(variable, location *TypeRef) bool {
+	if location.Kind == KindNonNull {
+		return variable.Kind == KindNonNull && isTypeSubtype(variable.OfType, location.OfType)
+	}
+	if variable.Kind == KindNonNull {
+		return isTypeSubtype(variable.OfType, location)
+	}
+	if location.Kind == KindList || variable.Kind == KindList {
+		return location.Kind == variable.Kind && isTypeSubtype(variable.OfType, location.OfType)
+	}
+	return variable.Name == location.Name
+}
+
+func isBuiltinScalar(name string) bool {
+	switch name {
+	case "Int", "Float", "String", "Boolean", "ID":
+		return true
+	}
+	return false
+}
+
+// isScalarLiteral checks literals of built-in scalars. Custom scalars like
+// DateTime or JSON accept any literal.
+func isScalarLiteral(scalar string, t Token) bool {
+	switch scalar {
+	case "Int":
+		return t.Kind == Int
+	case "Float":
+		return t.Kind == Int || t.Kind == Float
+	case "String":
+		return t.Kind == String || t.Kind == BlockString
+	case "Boolean":
+		return t.Is("true") || t.Is("false")
+	case "ID":
+		return t.Kind == Int || t.Kind == String || t.Kind == BlockString
+	}
+	return true
+}
+
+// skipValueTokens returns the tokens after the value at the start of the
+// tokens.
+func skipValueTokens(tokens []Token) []Token {
+	if tokens[0].Is("$") {
+		return tokens[2:]
+	}
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.Is("["), t.Is("{"):
+			depth++
+		case t.Is("]"), t.Is("}"):
+			depth--
+		}
+		if depth == 0 {
+			return tokens[i+1:]
+		}
+	}
+	return tokens[len(tokens)-1:]
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("graphql: %s: %s", e.Operation, e.Message)
+	}
+	return fmt.Sprintf("graphql: %s: %s: %s", e.Operation, e.Path, e.Message)
+}
+
+func (errs SchemaErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
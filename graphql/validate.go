@@ -0,0 +1,140 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+type (
+	// Error of a document which is syntactically correct but invalid.
+	ValidationError struct {
+		Message string
+	}
+)
+
+// ParseAndValidate parses and validates the document.
+func ParseAndValidate(src string) (*Document, error) {
+	doc, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return doc, doc.Validate()
+}
+
+// Validate checks names of operations and fragments, fragments which are
+// undefined, unused or cyclic, and variables which are undeclared or unused
+// in each operation.
+func (doc *Document) Validate() error {
+	names := map[string]bool{}
+	for _, op := range doc.Operations {
+		if op.Name == "" && len(doc.Operations) > 1 {
+			return validationErrorf("anonymous operation must be the only operation")
+		}
+		if names[op.Name] {
+			return validationErrorf("duplicate operation %s", op.Name)
+		}
+		names[op.Name] = true
+	}
+	fragments := map[string]*Fragment{}
+	for _, f := range doc.Fragments {
+		if fragments[f.Name] != nil {
+			return validationErrorf("duplicate fragment %s", f.Name)
+		}
+		fragments[f.Name] = f
+	}
+	for _, f := range doc.Fragments {
+		if err := checkCycle(fragments, f, nil); err != nil {
+			return err
+		}
+	}
+
+	usedFragments := map[string]bool{}
+	for _, op := range doc.Operations {
+		variables, err := doc.usedBy(fragments, &op.usage, usedFragments)
+		if err != nil {
+			return err
+		}
+		used := map[string]bool{}
+		for _, name := range variables {
+			used[name] = true
+		}
+		declared := map[string]bool{}
+		for _, v := range op.VariableDefinitions {
+			if declared[v.Name] {
+				return validationErrorf("duplicate variable $%s in %s", v.Name, op)
+			}
+			declared[v.Name] = true
+			if !used[v.Name] {
+				return validationErrorf("unused variable $%s in %s", v.Name, op)
+			}
+		}
+		for _, name := range variables {
+			if !declared[name] {
+				return validationErrorf("undeclared variable $%s in %s", name, op)
+			}
+		}
+	}
+	if len(doc.Operations) > 0 {
+		for _, f := range doc.Fragments {
+			if !usedFragments[f.Name] {
+				return validationErrorf("unused fragment %s", f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// usedBy returns variables used by the operation or fragment and its
+// fragments, and marks the fragments as used.
+func (doc *Document) usedBy(fragments map[string]*Fragment, u *usage, used map[string]bool) (variables []string, err error) {
+	visited := map[string]bool{}
+	queue := []*usage{u}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		variables = append(variables, u.variables...)
+		for _, name := range u.spreads {
+			f := fragments[name]
+			if f == nil {
+				return nil, validationErrorf("undefined fragment %s", name)
+			}
+			used[name] = true
+			if !visited[name] {
+				visited[name] = true
+				queue = append(queue, &f.usage)
+			}
+		}
+	}
+	return variables, nil
+}
+
+func checkCycle(fragments map[string]*Fragment, f *Fragment, path []string) error {
+	for _, name := range path {
+		if name == f.Name {
+			return validationErrorf("fragment %s spreads itself", f.Name)
+		}
+	}
+	path = append(path, f.Name)
+	for _, name := range f.spreads {
+		if next := fragments[name]; next != nil {
+			if err := checkCycle(fragments, next, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (op *Operation) String() string {
+	if op.Name == "" {
+		return "anonymous " + op.Type
+	}
+	return op.Type + " " + op.Name
+}
+
+func (e *ValidationError) Error() string {
+	return "graphql: " + e.Message
+}
+
+func validationErrorf(format string, a ...interface{}) error {
+	return &ValidationError{fmt.Sprintf(format, a...)}
+}
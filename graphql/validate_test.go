@@ -0,0 +1,44 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, src := range []string{
+		`{ a }`,
+		`query ($a: Int) { b(a: $a) }`,
+		`query ($a: Int) { ...F } fragment F on Q { ...G } fragment G on Q { b(a: $a) }`,
+		`query A { ...F } query B { ...F } fragment F on Q { a }`,
+		`fragment F on Q { a }`,
+	} {
+		if _, err := ParseAndValidate(src); err != nil {
+			t.Errorf("%q should be valid: %s", src, err)
+		}
+	}
+
+	for src, message := range map[string]string{
+		`{ a } { b }`:                 "anonymous operation must be the only operation",
+		`query A { a } query A { b }`: "duplicate operation A",
+		`{ ...F } fragment F on Q { a } fragment F on Q { b }`:         "duplicate fragment F",
+		`{ ...F } fragment F on Q { ...G } fragment G on Q { ...F }`:   "fragment F spreads itself",
+		`query ($a: Int, $a: Int) { b(a: $a) }`:                        "duplicate variable $a in anonymous query",
+		`query A($a: Int) { b }`:                                       "unused variable $a in query A",
+		`mutation { b(a: $a) }`:                                        "undeclared variable $a in anonymous mutation",
+		`query ($a: Int) { ...F } fragment F on Q { b(a: $a, c: $c) }`: "undeclared variable $c in anonymous query",
+		`{ ...F }`:                    "undefined fragment F",
+		`{ a } fragment F on Q { a }`: "unused fragment F",
+	} {
+		_, err := ParseAndValidate(src)
+		if err == nil {
+			t.Errorf("%q should be invalid", src)
+			continue
+		}
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("%q should return validation error", src)
+		}
+		if err.Error() != "graphql: "+message {
+			t.Errorf("%q has wrong error: %s", src, err)
+		}
+	}
+}
@@ -1,30 +1,84 @@
 package shopify
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
-	"regexp"
 	"strings"
+	"sync"
+
+	"github.com/caiguanhao/shopify/graphql"
 )
 
 var (
-	reOperationArgs = regexp.MustCompile(`([\w!]+)\s*:\s*([\w!]+)`)
+	ErrInvalidMulti = errors.New("invalid multi")
 )
 
 type (
 	Multi struct {
+		// Maximum number of operations in one request of Execute. No limit
+		// if zero.
+		MaxAliases int
+
+		// Maximum estimated query cost of one request of Execute. No limit
+		// if zero. See MultiItem.Cost.
+		MaxCost int
+
+		// Number of requests Execute sends at the same time, defaults to 1.
+		Concurrency int
+
 		operationType string
 		items         []*MultiItem
+		vars          []multiVar
+		fragments     []multiFragment
+		err           error
 	}
 
 	MultiItem struct {
 		multi      *Multi
 		operation  string
-		opArgTypes [][]string
+		opArgTypes []multiArg
 		bodyType   string
+		directives string // directives of the fragment spread of bodyType
 		body       string
 		inputs     []interface{}
 		targets    []interface{}
+		unitCost   int
+		names      []string // aliases or alias prefix set by Alias
+		keyBy      string
+		aliases    []string // alias of each input set, set by Do
+		errs       []error  // error of each input set, set by Execute
+	}
+
+	// MultiItemError is the error of an input set of an operation in Multi.
+	MultiItemError struct {
+		Operation string
+		Index     int   // index of the input set
+		Err       error // Errors, UserErrors or error of the request
+	}
+
+	// MultiErrors is returned by Multi.Execute if any operation fails.
+	MultiErrors []*MultiItemError
+
+	// An input set of an item.
+	multiUnit struct {
+		item  *MultiItem
+		index int // index of the input set in the item
+		n     int // index of the input set in the chain, used in variable names
+	}
+
+	// Variable shared by operations.
+	multiVar struct {
+		multiArg
+		value interface{}
+	}
+
+	// Entry of a map destination keyed by MultiItem.KeyBy, see arrange.
+	mapEntry struct {
+		m   reflect.Value
+		key reflect.Value
 	}
 )
 
@@ -38,77 +92,398 @@ func NewMulti(operationType string) *Multi {
 }
 
 // Add defines a new operation with its argument types. The operation argument
-// types must be in the format of "name: type".
+// types must be in the format of "name: type" or "name: type = default", like
+// "ids: [ID!]!" or "first: Int = 10". If the argument types are malformed,
+// the operation is not added and the error is returned by Err().
 func (m *Multi) Add(operation string, operationArgTypes ...string) *MultiItem {
-	argTypes := reOperationArgs.FindAllStringSubmatch(strings.Join(operationArgTypes, ", "), -1)
 	mi := &MultiItem{
-		multi:      m,
-		operation:  operation,
-		opArgTypes: argTypes,
+		multi:     m,
+		operation: operation,
 	}
+	argTypes, err := parseMultiArgs(strings.Join(operationArgTypes, ", "))
+	if err != nil {
+		if m.err == nil {
+			m.err = fmt.Errorf("invalid argument types of %s: %w", operation, err)
+		}
+		return mi
+	}
+	mi.opArgTypes = argTypes
 	m.items = append(m.items, mi)
 	return mi
+}
 
+// Var declares a variable shared by operations, which can be used in
+// argument types of Add like "locationId: $locationId" or in bodies. The type
+// can have a default value like "Int = 10", which is used if value is nil.
+// Shared variables are declared once in each request.
+func (m *Multi) Var(name, typ string, value interface{}) *Multi {
+	args, err := parseMultiArgs(name + ": " + typ)
+	if err == nil && (len(args) != 1 || args[0].variable != "") {
+		err = fmt.Errorf("expected one type")
+	}
+	if err == nil && m.sharedVar(name) != nil {
+		err = fmt.Errorf("duplicate variable")
+	}
+	if err != nil {
+		if m.err == nil {
+			m.err = fmt.Errorf("invalid variable %s: %w", name, err)
+		}
+		return m
+	}
+	m.vars = append(m.vars, multiVar{args[0], value})
+	return m
+}
+
+func (m *Multi) sharedVar(name string) *multiVar {
+	for i := range m.vars {
+		if m.vars[i].name == name {
+			return &m.vars[i]
+		}
+	}
+	return nil
+}
+
+// Err returns the first error occurred when defining operations.
+func (m *Multi) Err() error {
+	return m.err
 }
 
 // Do generates gql, args and targets that can be used in Client.New() and
-// Request.Do().
-func (m *Multi) Do() (gql string, args, targets []interface{}) {
+// Request.Do(). An error is returned if Err() is not nil or the operations
+// are invalid, see Validate. Input values of nil are omitted for arguments
+// with default values, so that the defaults are used. All operations are put
+// in one document, use Execute to split them by MaxAliases and MaxCost.
+func (m *Multi) Do() (gql string, args, targets []interface{}, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	units := m.units()
+	m.prepareTargets()
+	gql, args = m.build(units)
+	targets = m.unitTargets(units)
+	return
+}
+
+// Validate returns the error of Add, or an error wrapping ErrInvalidMulti if
+// the operation type is not query or mutation, an operation name is not a
+// field name, a body is empty, number of inputs is not a multiple of number
+// of arguments, destinations are not pointers followed by string paths, or
+// the generated document is not valid, see graphql.Document.Validate.
+func (m *Multi) Validate() error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.operationType != "query" && m.operationType != "mutation" {
+		return fmt.Errorf("%w: operation type must be query or mutation, not %q", ErrInvalidMulti, m.operationType)
+	}
+	if len(m.items) == 0 {
+		return fmt.Errorf("%w: no operations", ErrInvalidMulti)
+	}
+	for i, item := range m.items {
+		if err := item.validate(); err != nil {
+			return fmt.Errorf("%w: operation #%d %s: %s", ErrInvalidMulti, i, item.operation, err)
+		}
+	}
+	var bodies []string
+	for i, item := range m.items {
+		for _, arg := range item.opArgTypes {
+			if arg.variable != "" && m.sharedVar(arg.variable) == nil {
+				return fmt.Errorf("%w: operation #%d %s: undeclared variable $%s", ErrInvalidMulti, i, item.operation, arg.variable)
+			}
+		}
+		bodies = append(bodies, item.body)
+	}
+	if _, err := m.usedFragments(bodies); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMulti, err)
+	}
+	seen := map[string]bool{}
+	for _, u := range m.units() {
+		for _, arg := range u.item.opArgTypes {
+			if name := fmt.Sprintf("%s%d", arg.name, u.n); arg.variable == "" && m.sharedVar(name) != nil {
+				return fmt.Errorf("%w: variable $%s is used by operation %s", ErrInvalidMulti, name, u.item.operation)
+			}
+		}
+		alias := u.alias()
+		if p := (&multiArgParser{src: alias}); p.name() != alias || alias == "" {
+			return fmt.Errorf("%w: invalid alias %q", ErrInvalidMulti, alias)
+		}
+		if seen[alias] {
+			return fmt.Errorf("%w: duplicate alias %q", ErrInvalidMulti, alias)
+		}
+		seen[alias] = true
+	}
+	gql, _ := m.build(m.units())
+	if _, err := graphql.ParseAndValidate(gql); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMulti, err)
+	}
+	return nil
+}
+
+// Execute runs the operations with the client and puts results into the
+// destinations of each item. Unlike Request.Do, results of successful
+// operations are still set if other operations fail. Errors of each item can
+// be found by MultiItem.Err() and MultiItem.Errors(). If any operation fails,
+// MultiErrors is returned.
+//
+// Operations are split into several requests if MaxAliases or MaxCost is
+// set. Requests are sent in order, or at most Concurrency at the same time,
+// waiting for enough available query cost of the client. If a request
+// fails, its error is set to every item in it. GraphQL errors are set to the
+// operations of their paths, and errors without a known path are set to
+// operations without data.
+func (m *Multi) Execute(ctx context.Context, client *Client) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	units := m.units()
+	for _, item := range m.items {
+		item.errs = make([]error, len(item.aliases))
+	}
+	m.prepareTargets()
+	chunks := m.chunk(units)
+	concurrency := m.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			for _, u := range chunk {
+				u.item.errs[u.index] = &MultiItemError{u.item.operation, u.index, ctx.Err()}
+			}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(chunk []multiUnit) {
+			defer func() { <-sem; wg.Done() }()
+			m.executeChunk(ctx, client, chunk, &mu)
+		}(chunk)
+	}
+	wg.Wait()
+
+	var errs MultiErrors
+	for _, item := range m.items {
+		for _, err := range item.errs {
+			if err != nil {
+				errs = append(errs, err.(*MultiItemError))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (m *Multi) executeChunk(ctx context.Context, client *Client, units []multiUnit, mu *sync.Mutex) {
+	var cost float64
+	for _, u := range units {
+		cost += u.cost()
+	}
+	reserved, err := client.waitThrottle(ctx, cost)
+	var b []byte
+	var resp gqlResponse
+	if err == nil {
+		gql, args := m.build(units)
+		req := client.New(gql, args...).WithContext(ctx)
+		req.reserved = reserved
+		b, resp, err = req.exec()
+	}
+	if err == nil && resp.Data == nil && len(resp.Errors) > 0 {
+		err = resp.Errors
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		for _, u := range units {
+			u.item.errs[u.index] = &MultiItemError{u.item.operation, u.index, err}
+		}
+		return
+	}
+
+	var unmatched Errors
+	errsByAlias := map[string]Errors{}
+	for _, e := range resp.Errors {
+		errsByAlias[e.firstPath()] = append(errsByAlias[e.firstPath()], e)
+	}
+	for alias, errs := range errsByAlias {
+		if !unitsContain(units, alias) {
+			unmatched = append(unmatched, errs...)
+		}
+	}
+	var respWithUserErrors gqlResponseUserErrors
+	json.Unmarshal(b, &respWithUserErrors)
+	var data map[string]json.RawMessage
+	if resp.Data != nil {
+		json.Unmarshal(*resp.Data, &data)
+	}
+	for _, u := range units {
+		alias := u.alias()
+		var err error
+		if errs := errsByAlias[alias]; len(errs) > 0 {
+			err = errs
+		} else if len(unmatched) > 0 && isNullJSON(data[alias]) {
+			err = unmatched
+		} else if userErrors := respWithUserErrors.Data[alias]["userErrors"]; userErrors != nil && len(*userErrors) > 0 {
+			err = *userErrors
+		}
+		if err != nil {
+			u.item.errs[u.index] = &MultiItemError{u.item.operation, u.index, err}
+		}
+	}
+
+	if resp.Data != nil {
+		targets := m.unitTargets(units)
+		for n := 0; n < len(targets)/2; n++ {
+			arrange(*resp.Data, targets[2*n], targets[2*n+1].(string))
+		}
+	}
+}
+
+// isNullJSON reports whether the value is missing or null.
+func isNullJSON(b json.RawMessage) bool {
+	return len(b) == 0 || string(b) == "null"
+}
+
+// units returns input sets of all items in order, and sets aliases of items.
+func (m *Multi) units() (units []multiUnit) {
+	c := 0
+	for _, item := range m.items {
+		item.aliases = nil
+		n := item.numberOfInputSets()
+		for i := 0; i < n; i++ {
+			var alias string
+			if len(item.names) == n {
+				alias = item.names[i]
+			} else if len(item.names) > 0 {
+				alias = fmt.Sprintf("%s%d", item.names[0], i)
+			} else {
+				alias = fmt.Sprintf("gql%d", c)
+			}
+			item.aliases = append(item.aliases, alias)
+			units = append(units, multiUnit{item, i, c})
+			c += 1
+		}
+	}
+	return
+}
+
+// chunk splits units by MaxAliases and MaxCost. A unit costing more than
+// MaxCost is put in a chunk of its own.
+func (m *Multi) chunk(units []multiUnit) (chunks [][]multiUnit) {
+	var current []multiUnit
+	var cost float64
+	for _, u := range units {
+		c := u.cost()
+		if len(current) > 0 && (m.MaxAliases > 0 && len(current) >= m.MaxAliases ||
+			m.MaxCost > 0 && cost+c > float64(m.MaxCost)) {
+			chunks = append(chunks, current)
+			current, cost = nil, 0
+		}
+		current = append(current, u)
+		cost += c
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return
+}
+
+// prepareTargets makes destinations of [][]type to have one element for
+// each input set, and makes new maps for keyed destinations.
+func (m *Multi) prepareTargets() {
+	for _, item := range m.items {
+		n := item.numberOfInputSets()
+		for i := 0; i < len(item.targets)/2; i++ {
+			rv := reflect.Indirect(reflect.ValueOf(item.targets[2*i]))
+			if item.keyBy != "" && rv.Kind() == reflect.Map {
+				rv.Set(reflect.MakeMapWithSize(rv.Type(), n))
+			} else if rv.Kind() == reflect.Slice {
+				if elemType := rv.Type().Elem(); elemType.Kind() == reflect.Slice { // [][]type
+					rv.Set(reflect.MakeSlice(reflect.SliceOf(elemType), n, n))
+				}
+			}
+		}
+	}
+}
+
+// build generates the document of the units. Fragments are only included if
+// used.
+func (m *Multi) build(units []multiUnit) (gql string, args []interface{}) {
 	var gqlIns []string
 	var ops []string
 	var fragments []string
-	c, d, f := 0, 0, 0
+	fragmentNames := map[string]string{} // same fragments share one name
 	for _, item := range m.items {
-		x := 0
+		if key := item.fragment(); key != "" && fragmentNames[key] == "" {
+			fragmentNames[key] = fmt.Sprintf("frag%d", len(fragmentNames))
+		}
+	}
+	used := map[string]bool{} // fragments and shared variables in the document
+	declare := func(v *multiVar) {
+		if used["$"+v.name] {
+			return
+		}
+		gqlIns = append(gqlIns, fmt.Sprintf("$%s: %s", v.name, v.declaration()))
+		if v.value != nil || v.defaultValue == "" { // nil uses the default value
+			args = append(args, v.name, v.value)
+		}
+		used["$"+v.name] = true
+	}
+	for _, u := range units {
+		item := u.item
 		body := item.body
-		if item.bodyType != "" {
-			fragments = append(fragments, fmt.Sprintf("fragment frag%d on %s %s\n", f, item.bodyType, body))
-			body = fmt.Sprintf("{ ...frag%d }", f)
-			f += 1
-		}
-		var numberOfItems int
-		if len(item.opArgTypes) > 0 {
-			numberOfItems = len(item.inputs) / len(item.opArgTypes)
-		}
-		if numberOfItems < 1 {
-			numberOfItems = 1
-		}
-		for i := 0; i < numberOfItems; i++ {
-			var opIns []string
-			for j := range item.opArgTypes {
-				name := item.opArgTypes[j][1]
-				typ := item.opArgTypes[j][2]
-				opIns = append(opIns, fmt.Sprintf("%s: $%s%d", name, name, c))
-				gqlIns = append(gqlIns, fmt.Sprintf("$%s%d: %s", name, c, typ))
-				args = append(args, fmt.Sprintf("%s%d", name, c), item.inputs[x])
-				x += 1
-			}
-			opIn := strings.Join(opIns, ", ")
-			if opIn != "" {
-				opIn = "(" + opIn + ")"
+		if key := item.fragment(); key != "" {
+			name := fragmentNames[key]
+			if !used[key] {
+				fragments = append(fragments, fmt.Sprintf("fragment %s on %s %s\n", name, item.bodyType, item.body))
+				used[key] = true
 			}
-			ops = append(ops, fmt.Sprintf("gql%d: %s%s %s\n", c, item.operation, opIn, body))
-			c += 1
+			body = fmt.Sprintf("{ ...%s }", strings.TrimSpace(name+" "+item.directives))
 		}
-		for n := 0; n < len(item.targets)/2; n++ {
-			path, ok := item.targets[2*n+1].(string)
-			if !ok {
+		alias := u.alias()
+		var opIns []string
+		x := u.index * item.numberOfInputArgs()
+		for _, arg := range item.opArgTypes {
+			if arg.variable != "" {
+				opIns = append(opIns, fmt.Sprintf("%s: $%s", arg.name, arg.variable))
+				declare(m.sharedVar(arg.variable))
 				continue
 			}
-			rv := reflect.Indirect(reflect.ValueOf(item.targets[2*n]))
-			if rv.Kind() == reflect.Slice {
-				if elemType := rv.Type().Elem(); elemType.Kind() == reflect.Slice { // [][]type
-					rv.Set(reflect.MakeSlice(reflect.SliceOf(elemType), numberOfItems, numberOfItems))
-					for i := 0; i < numberOfItems; i++ {
-						targets = append(targets, rv.Index(i).Addr().Interface(), fmt.Sprintf("gql%d%s", d+i, path))
-					}
-					continue
-				}
+			name := fmt.Sprintf("%s%d", arg.name, u.n)
+			opIns = append(opIns, fmt.Sprintf("%s: $%s", arg.name, name))
+			gqlIns = append(gqlIns, fmt.Sprintf("$%s: %s", name, arg.declaration()))
+			var value interface{}
+			if x < len(item.inputs) {
+				value = item.inputs[x]
 			}
-			targets = append(targets, item.targets[2*n], fmt.Sprintf("gql%d%s", d+numberOfItems-1, path))
-			continue
+			if value != nil || arg.defaultValue == "" {
+				args = append(args, name, value)
+			}
+			x += 1
+		}
+		opIn := strings.Join(opIns, ", ")
+		if opIn != "" {
+			opIn = "(" + opIn + ")"
+		}
+		ops = append(ops, fmt.Sprintf("%s: %s%s %s\n", alias, item.operation, opIn, body))
+	}
+	var bodies []string
+	for _, u := range units {
+		bodies = append(bodies, u.item.body)
+	}
+	named, _ := m.usedFragments(bodies) // validated
+	fragments = append(fragments, named...)
+	for _, name := range bodyVariables(fragments, ops) { // shared variables used in bodies
+		if v := m.sharedVar(name); v != nil {
+			declare(v)
 		}
-		d += numberOfItems
 	}
 	gqlIn := strings.Join(gqlIns, ", ")
 	if gqlIn != "" {
@@ -118,6 +493,38 @@ func (m *Multi) Do() (gql string, args, targets []interface{}) {
 	return
 }
 
+// unitTargets returns destinations followed by JSON paths of the units.
+// Destinations of [][]type and maps keyed by KeyBy get results of each input
+// set, others get results of the last input set.
+func (m *Multi) unitTargets(units []multiUnit) (targets []interface{}) {
+	for start := 0; start < len(units); {
+		item := units[start].item
+		end := start
+		for end < len(units) && units[end].item == item {
+			end++
+		}
+		last := item.numberOfInputSets() - 1
+		for n := 0; n < len(item.targets)/2; n++ {
+			path := item.targets[2*n+1].(string)
+			rv := reflect.Indirect(reflect.ValueOf(item.targets[2*n]))
+			isSliceOfSlice := rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Slice
+			isKeyed := item.keyBy != "" && rv.Kind() == reflect.Map
+			for _, u := range units[start:end] {
+				if isKeyed {
+					key, _ := mapKey(item.keyOf(u.index), rv.Type().Key())
+					targets = append(targets, &mapEntry{rv, key}, u.alias()+path)
+				} else if isSliceOfSlice {
+					targets = append(targets, rv.Index(u.index).Addr().Interface(), u.alias()+path)
+				} else if u.index == last {
+					targets = append(targets, item.targets[2*n], u.alias()+path)
+				}
+			}
+		}
+		start = end
+	}
+	return
+}
+
 // Len returns number of items in the chain.
 func (m Multi) Len() int {
 	return len(m.items)
@@ -132,20 +539,27 @@ func (m Multi) String() string {
 }
 
 // Return defines output fields of a operation. This is the body of the GraphQL
-// query. If the body starts with corresponding type, then fragment will be
-// used.
+// query. If the body starts with corresponding type, like "Product { id }",
+// then fragment will be used. The type must start with an uppercase letter,
+// so a field with a selection set must be put in braces, like
+// "{ edges { node { id } } }". The body can have inline fragments,
+// directives and named fragments defined by Multi.Fragment. Other fields
+// without braces, like "id title", are put in braces. If the body is
+// malformed, the error is returned by Multi.Err().
 func (mi *MultiItem) Return(body string) *MultiItem {
-	var bodyType string
-	if i := strings.Index(body, "{"); i > -1 {
-		bodyType = strings.TrimSpace(body[0:i])
-		body = body[i:]
+	bodyType, directives, body, err := parseBody(body)
+	if err != nil && mi.multi.err == nil {
+		mi.multi.err = fmt.Errorf("invalid body of %s: %w", mi.operation, err)
 	}
 	mi.bodyType = bodyType
+	mi.directives = directives
 	mi.body = body
 	return mi
 }
 
 // In puts input values in the order of the operation argument types to the chain.
+// It can be omitted if every argument has a default value or a nullable
+// type, then the operation has one input set with all arguments omitted.
 func (mi *MultiItem) In(args ...interface{}) *MultiItem {
 	mi.inputs = args
 	return mi
@@ -157,15 +571,223 @@ func (mi *MultiItem) Out(targets ...interface{}) *MultiItem {
 	return mi
 }
 
+// Cost sets the estimated query cost of each input set of the operation,
+// used to split requests by Multi.MaxCost. If not set, the cost is estimated
+// from the body like Shopify calculates the requested query cost: mutations
+// cost 10, objects cost 1, scalars cost 0, and connections cost 2 plus the
+// cost of their nodes multiplied by the first or last argument.
+func (mi *MultiItem) Cost(cost int) *MultiItem {
+	mi.unitCost = cost
+	return mi
+}
+
+// Alias sets aliases of the operation, to make the document easier to read.
+// If the number of aliases is the same as the number of input sets, each
+// input set uses its alias, otherwise the first alias is used as a prefix
+// followed by the index of the input set. Defaults to "gql" followed by the
+// index of the input set in the chain.
+func (mi *MultiItem) Alias(aliases ...string) *MultiItem {
+	mi.names = aliases
+	return mi
+}
+
+// KeyBy makes map destinations of Out keyed by the input value of the
+// argument, like the id of a product, instead of getting results of the
+// last input set. String keys can be used for values of any type.
+func (mi *MultiItem) KeyBy(argName string) *MultiItem {
+	mi.keyBy = argName
+	return mi
+}
+
+// Err returns the first error of the item after Multi.Execute, or nil if all
+// input sets of the item succeed.
+func (mi *MultiItem) Err() error {
+	for _, err := range mi.errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Errors returns the error of each input set of the item after
+// Multi.Execute, in the order of the inputs. Successful ones are nil.
+func (mi *MultiItem) Errors() []error {
+	return mi.errs
+}
+
 // Self returns the chain.
 func (mi *MultiItem) Self() *Multi {
 	return mi.multi
 }
 
+func (mi *MultiItem) validate() error {
+	if p := (&multiArgParser{src: mi.operation}); p.name() != mi.operation || mi.operation == "" {
+		return errors.New("operation must be a field name, the operation type is set by NewMulti")
+	}
+	if body := strings.TrimSpace(mi.body); !strings.HasPrefix(body, "{") || !strings.HasSuffix(body, "}") ||
+		strings.TrimSpace(body[1:len(body)-1]) == "" {
+		return errors.New("body must be fields in braces")
+	}
+	if n := mi.numberOfInputArgs(); n == 0 && len(mi.inputs) > 0 {
+		return fmt.Errorf("%d inputs but no arguments", len(mi.inputs))
+	} else if n > 0 && len(mi.inputs)%n != 0 {
+		return fmt.Errorf("%d inputs is not a multiple of %d arguments", len(mi.inputs), n)
+	} else if n > 0 && len(mi.inputs) == 0 && !mi.argsOptional() {
+		return errors.New("no inputs for required arguments")
+	}
+	if len(mi.targets)%2 != 0 {
+		return errors.New("destinations must be followed by paths")
+	}
+	for i := 0; i < len(mi.targets); i += 2 {
+		rv := reflect.ValueOf(mi.targets[i])
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return fmt.Errorf("destination #%d must be a non-nil pointer", i/2)
+		}
+		if _, ok := mi.targets[i+1].(string); !ok {
+			return fmt.Errorf("path of destination #%d must be a string", i/2)
+		}
+		if mi.keyBy == "" || rv.Elem().Kind() != reflect.Map {
+			continue
+		}
+		for j := 0; j < mi.numberOfInputSets(); j++ {
+			if _, ok := mapKey(mi.keyOf(j), rv.Elem().Type().Key()); !ok {
+				return fmt.Errorf("input %v of %s can not be key of destination #%d", mi.keyOf(j), mi.keyBy, i/2)
+			}
+		}
+	}
+	if n := len(mi.names); n > 1 && n != mi.numberOfInputSets() {
+		return fmt.Errorf("%d aliases for %d input sets", n, mi.numberOfInputSets())
+	}
+	if mi.keyBy != "" && mi.argIndex(mi.keyBy) < 0 {
+		return fmt.Errorf("no argument %s to key by", mi.keyBy)
+	}
+	return nil
+}
+
+// argIndex returns the index of the argument in an input set, or -1 if it
+// does not exist or uses a shared variable.
+func (mi *MultiItem) argIndex(name string) int {
+	i := 0
+	for _, arg := range mi.opArgTypes {
+		if arg.variable != "" {
+			if arg.name == name {
+				return -1
+			}
+			continue
+		}
+		if arg.name == name {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// keyOf returns the input value of the KeyBy argument of the input set.
+func (mi *MultiItem) keyOf(index int) interface{} {
+	i := index*mi.numberOfInputArgs() + mi.argIndex(mi.keyBy)
+	if mi.argIndex(mi.keyBy) < 0 || i >= len(mi.inputs) {
+		return nil
+	}
+	return mi.inputs[i]
+}
+
+// argsOptional reports whether all arguments not using shared variables have
+// default values or nullable types, so that the operation can have no
+// inputs.
+func (mi *MultiItem) argsOptional() bool {
+	for _, arg := range mi.opArgTypes {
+		if arg.variable == "" && arg.defaultValue == "" && strings.HasSuffix(arg.typ, "!") {
+			return false
+		}
+	}
+	return true
+}
+
+// numberOfInputArgs returns number of arguments not using shared variables.
+func (mi *MultiItem) numberOfInputArgs() (n int) {
+	for _, arg := range mi.opArgTypes {
+		if arg.variable == "" {
+			n++
+		}
+	}
+	return
+}
+
+// fragment returns the type and body of the fragment of the operation, or an
+// empty string if it does not use a fragment.
+func (mi *MultiItem) fragment() string {
+	if mi.bodyType == "" {
+		return ""
+	}
+	return mi.bodyType + " " + mi.body
+}
+
+func (mi *MultiItem) numberOfInputSets() int {
+	var n int
+	if args := mi.numberOfInputArgs(); args > 0 {
+		n = len(mi.inputs) / args
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (u multiUnit) alias() string {
+	return u.item.aliases[u.index]
+}
+
+// input returns the value of the argument of the operation in the input
+// set, or nil if it is not set.
+func (u multiUnit) input(name string) interface{} {
+	item := u.item
+	x := u.index * item.numberOfInputArgs()
+	for _, arg := range item.opArgTypes {
+		if arg.variable != "" {
+			if v := item.multi.sharedVar(arg.variable); arg.name == name && v != nil {
+				return v.value
+			}
+			continue
+		}
+		if arg.name == name && x < len(item.inputs) {
+			return item.inputs[x]
+		}
+		x += 1
+	}
+	return nil
+}
+
+// mapKey converts the input value to the key type of a map. Values of other
+// types are formatted for string keys.
+func mapKey(value interface{}, typ reflect.Type) (reflect.Value, bool) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return rv, false
+	}
+	if rv.Type().ConvertibleTo(typ) && (typ.Kind() != reflect.String || rv.Kind() == reflect.String) {
+		return rv.Convert(typ), true
+	}
+	if typ.Kind() == reflect.String {
+		return reflect.ValueOf(fmt.Sprint(value)).Convert(typ), true
+	}
+	return rv, false
+}
+
+func unitsContain(units []multiUnit, alias string) bool {
+	for _, u := range units {
+		if u.alias() == alias {
+			return true
+		}
+	}
+	return false
+}
+
 func (mi MultiItem) String() string {
 	var list []string
 	for i := range mi.opArgTypes {
-		list = append(list, mi.opArgTypes[i][1]+": "+mi.opArgTypes[i][2])
+		list = append(list, mi.opArgTypes[i].String())
 	}
 	args := strings.Join(list, ", ")
 	if args != "" {
@@ -173,3 +795,19 @@ func (mi MultiItem) String() string {
 	}
 	return mi.operation + args + " " + mi.body
 }
+
+func (e *MultiItemError) Error() string {
+	return fmt.Sprintf("%s[%d]: %s", e.Operation, e.Index, e.Err)
+}
+
+func (e *MultiItemError) Unwrap() error {
+	return e.Err
+}
+
+func (errs MultiErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
@@ -0,0 +1,193 @@
+package shopify
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Argument of an operation in Multi, like "ids: [ID!]!",
+	// "first: Int = 10" or "locationId: $locationId".
+	multiArg struct {
+		name         string
+		typ          string
+		defaultValue string
+		variable     string // name of the shared variable used
+	}
+
+	// Parser of GraphQL argument definitions. Commas are insignificant like
+	// whitespace in GraphQL.
+	multiArgParser struct {
+		src string
+		pos int
+	}
+)
+
+// Type and default value of the argument, used in variable definitions.
+func (a multiArg) declaration() string {
+	if a.defaultValue == "" {
+		return a.typ
+	}
+	return a.typ + " = " + a.defaultValue
+}
+
+func (a multiArg) String() string {
+	if a.variable != "" {
+		return a.name + ": $" + a.variable
+	}
+	return a.name + ": " + a.declaration()
+}
+
+func parseMultiArgs(src string) (args []multiArg, err error) {
+	p := &multiArgParser{src: src}
+	seen := map[string]bool{}
+	for p.skip(); p.pos < len(p.src); p.skip() {
+		var arg multiArg
+		if arg.name = p.name(); arg.name == "" {
+			return nil, p.errorf("expected argument name")
+		}
+		if seen[arg.name] {
+			return nil, p.errorf("duplicate argument %s", arg.name)
+		}
+		seen[arg.name] = true
+		if !p.consume(':') {
+			return nil, p.errorf("expected \":\" after %s", arg.name)
+		}
+		if p.consume('$') {
+			if arg.variable = p.name(); arg.variable == "" {
+				return nil, p.errorf("expected variable name")
+			}
+			args = append(args, arg)
+			continue
+		}
+		if arg.typ, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if p.consume('=') {
+			p.skip()
+			start := p.pos
+			if err = p.value(); err != nil {
+				return nil, err
+			}
+			arg.defaultValue = strings.TrimSpace(p.src[start:p.pos])
+		}
+		args = append(args, arg)
+	}
+	return
+}
+
+// typ parses a named type, a list type or a non-null type, like
+// "[[Int!]]!", and returns it without whitespace.
+func (p *multiArgParser) typ() (typ string, err error) {
+	if p.consume('[') {
+		if typ, err = p.typ(); err != nil {
+			return
+		}
+		if !p.consume(']') {
+			return "", p.errorf("expected \"]\"")
+		}
+		typ = "[" + typ + "]"
+	} else if typ = p.name(); typ == "" {
+		return "", p.errorf("expected type")
+	}
+	if p.consume('!') {
+		typ += "!"
+	}
+	return
+}
+
+// value skips a constant value, like 10, "a", ENUM, [1, 2] or {a: 1}.
+func (p *multiArgParser) value() error {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return p.errorf("expected value")
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '[':
+		p.pos++
+		for !p.consume(']') {
+			if err := p.value(); err != nil {
+				return err
+			}
+		}
+	case c == '{':
+		p.pos++
+		for !p.consume('}') {
+			if p.name() == "" {
+				return p.errorf("expected field name")
+			}
+			if !p.consume(':') {
+				return p.errorf("expected \":\"")
+			}
+			if err := p.value(); err != nil {
+				return err
+			}
+		}
+	case c == '"':
+		for p.pos++; ; p.pos++ {
+			if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+				return p.errorf("unterminated string")
+			}
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			} else if p.src[p.pos] == '"' {
+				p.pos++
+				break
+			}
+		}
+	case c == '-' || isDigit(c):
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || strings.IndexByte("-+.eE", p.src[p.pos]) > -1) {
+			p.pos++
+		}
+		if p.pos == start+1 && c == '-' {
+			return p.errorf("invalid number")
+		}
+	case isNameStart(c):
+		p.name()
+	default:
+		return p.errorf("unexpected %q", c)
+	}
+	return nil
+}
+
+func (p *multiArgParser) name() string {
+	p.skip()
+	start := p.pos
+	if p.pos < len(p.src) && isNameStart(p.src[p.pos]) {
+		for p.pos++; p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || isDigit(p.src[p.pos])); p.pos++ {
+		}
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *multiArgParser) consume(c byte) bool {
+	p.skip()
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *multiArgParser) skip() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n,", p.src[p.pos]) > -1 {
+		p.pos++
+	}
+}
+
+func (p *multiArgParser) errorf(format string, a ...interface{}) error {
+	if p.pos >= len(p.src) {
+		return fmt.Errorf(format+" at end of %q", append(a, p.src)...)
+	}
+	return fmt.Errorf(format+" at position %d of %q", append(a, p.pos, p.src)...)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
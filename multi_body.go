@@ -0,0 +1,358 @@
+package shopify
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+var (
+	reGeneratedFragment = regexp.MustCompile(`^frag\d+$`)
+)
+
+type (
+	// TypedResult is a result of an interface or union type, like nodes of
+	// nodes(ids:), which can be decoded by its __typename. __typename is
+	// added automatically to bodies with inline fragments.
+	TypedResult struct {
+		Typename string
+		Raw      json.RawMessage
+	}
+
+	// Named fragment shared by operations of Multi.
+	multiFragment struct {
+		name string
+		typ  string
+		body string
+	}
+)
+
+func (r *TypedResult) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*r = TypedResult{}
+		return nil
+	}
+	var t struct {
+		Typename string `json:"__typename"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	r.Typename = t.Typename
+	r.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+func (r TypedResult) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return []byte("null"), nil
+	}
+	return r.Raw, nil
+}
+
+// Decode unmarshals the result into v, usually a struct chosen by Typename.
+func (r TypedResult) Decode(v interface{}) error {
+	if r.Raw == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Raw, v)
+}
+
+// Fragment defines a named fragment which can be used in bodies of
+// operations like "{ ...ProductFields }". The body must start with the type,
+// which starts with an uppercase letter, like "Product { id title }". Only fragments used are put in the document.
+func (m *Multi) Fragment(name, body string) *Multi {
+	typ, directives, body, err := parseBody(body)
+	if err == nil && typ == "" {
+		err = fmt.Errorf("type is required")
+	}
+	if directives != "" {
+		typ += " " + directives
+	}
+	if p := (&multiArgParser{src: name}); err == nil && (p.name() != name || name == "" || name == "on") {
+		err = fmt.Errorf("invalid name")
+	}
+	if err == nil && (reGeneratedFragment.MatchString(name) || m.namedFragment(name) != nil) {
+		err = fmt.Errorf("duplicate name")
+	}
+	if err != nil {
+		if m.err == nil {
+			m.err = fmt.Errorf("invalid fragment %s: %w", name, err)
+		}
+		return m
+	}
+	m.fragments = append(m.fragments, multiFragment{name, typ, body})
+	return m
+}
+
+func (m *Multi) namedFragment(name string) *multiFragment {
+	for i := range m.fragments {
+		if m.fragments[i].name == name {
+			return &m.fragments[i]
+		}
+	}
+	return nil
+}
+
+// usedFragments returns definitions of named fragments used by the bodies,
+// including the ones used by other fragments, in the order of declaration.
+func (m *Multi) usedFragments(bodies []string) (definitions []string, err error) {
+	used := map[string]bool{}
+	for len(bodies) > 0 {
+		body := bodies[0]
+		bodies = bodies[1:]
+		for _, name := range fragmentSpreads(body) {
+			if used[name] {
+				continue
+			}
+			f := m.namedFragment(name)
+			if f == nil {
+				return nil, fmt.Errorf("undefined fragment %s", name)
+			}
+			used[name] = true
+			bodies = append(bodies, f.body)
+		}
+	}
+	for _, f := range m.fragments {
+		if used[f.name] {
+			definitions = append(definitions, fmt.Sprintf("fragment %s on %s %s\n", f.name, f.typ, f.body))
+		}
+	}
+	return
+}
+
+// parseBody splits the body of an operation or a fragment into the type
+// condition, the directives and the selection set, like "Product",
+// "@skip(if: false)" and "{ id }". Fields without braces, like "id title" or
+// "... on Product { id }", are put in braces. A name followed by a selection
+// set is the type condition only if it starts with an uppercase letter,
+// otherwise it is an error, since it is likely a field without braces, like
+// "edges { node { id } }".
+func parseBody(src string) (typ, directives, body string, err error) {
+	tokens, err := graphql.Lex(src)
+	if err != nil {
+		return
+	}
+	if tokens[0].Kind == graphql.EOF {
+		return
+	}
+	i := 0
+	if tokens[0].Kind == graphql.Name {
+		for i = 1; tokens[i].Is("@"); { // directives of the fragment
+			if tokens[i+1].Kind != graphql.Name {
+				return "", "", "", &graphql.SyntaxError{Message: "expected directive name", Pos: tokens[i+1].Pos}
+			}
+			if i += 2; tokens[i].Is("(") {
+				if i, err = skipBlock(tokens, i); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if !tokens[i].Is("{") {
+		return parseBody("{ " + src + " }")
+	}
+	end, err := skipBlock(tokens, i)
+	if err != nil {
+		return
+	}
+	if tokens[end].Kind != graphql.EOF {
+		return "", "", "", &graphql.SyntaxError{Message: "unexpected " + tokens[end].String(), Pos: tokens[end].Pos}
+	}
+	if i > 0 {
+		if c := tokens[0].Value[0]; c < 'A' || c > 'Z' {
+			return "", "", "", &graphql.SyntaxError{Message: "expected type name, got " + tokens[0].String() + ", put fields in braces", Pos: tokens[0].Pos}
+		}
+		typ = tokens[0].Value
+		directives = strings.TrimSpace(src[tokens[1].Pos:tokens[i].Pos])
+	}
+	body, err = addTypename(src[tokens[i].Pos:tokens[end-1].End()])
+	return
+}
+
+// skipBlock returns the index of the token after the block starting at
+// tokens[i], which is one of "{", "(" and "[".
+func skipBlock(tokens []graphql.Token, i int) (int, error) {
+	var stack []string
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.Is("{"):
+			stack = append(stack, "}")
+		case t.Is("("):
+			stack = append(stack, ")")
+		case t.Is("["):
+			stack = append(stack, "]")
+		case t.Is("}"), t.Is(")"), t.Is("]"):
+			if len(stack) == 0 || stack[len(stack)-1] != t.Value {
+				return i, &graphql.SyntaxError{Message: "unexpected " + t.String(), Pos: t.Pos}
+			}
+			if stack = stack[:len(stack)-1]; len(stack) == 0 {
+				return i + 1, nil
+			}
+		case t.Kind == graphql.EOF:
+			return i, &graphql.SyntaxError{Message: "unexpected " + t.String(), Pos: t.Pos}
+		}
+	}
+	return i, nil
+}
+
+// addTypename adds __typename to the selection set if it has inline
+// fragments but not __typename.
+func addTypename(body string) (string, error) {
+	tokens, err := graphql.Lex(body)
+	if err != nil {
+		return "", err
+	}
+	depth := 0
+	var inlineFragment bool
+	for i, t := range tokens {
+		switch {
+		case t.Is("{"), t.Is("("), t.Is("["):
+			depth++
+		case t.Is("}"), t.Is(")"), t.Is("]"):
+			depth--
+		case depth == 1 && t.Is("__typename"):
+			return body, nil
+		case depth == 1 && t.Is("...") && !isFragmentSpread(tokens, i):
+			inlineFragment = true
+		}
+	}
+	if !inlineFragment {
+		return body, nil
+	}
+	return "{ __typename " + strings.TrimLeft(body[1:], " \t\r\n,"), nil
+}
+
+// fragmentSpreads returns names of named fragments used in the body.
+func fragmentSpreads(body string) (names []string) {
+	tokens, _ := graphql.Lex(body)
+	for i := range tokens {
+		if isFragmentSpread(tokens, i) {
+			names = append(names, tokens[i+1].Value)
+		}
+	}
+	return
+}
+
+// bodyVariables returns names of variables used in the bodies.
+func bodyVariables(bodies ...[]string) (names []string) {
+	for _, list := range bodies {
+		for _, body := range list {
+			tokens, _ := graphql.Lex(body)
+			for i := 0; i+1 < len(tokens); i++ {
+				if tokens[i].Is("$") && tokens[i+1].Kind == graphql.Name {
+					names = append(names, tokens[i+1].Value)
+				}
+			}
+		}
+	}
+	return
+}
+
+func isFragmentSpread(tokens []graphql.Token, i int) bool {
+	return tokens[i].Is("...") && i+1 < len(tokens) &&
+		tokens[i+1].Kind == graphql.Name && tokens[i+1].Value != "on"
+}
+
+// cost returns the query cost of the input set set by MultiItem.Cost, or
+// the cost estimated from the body.
+func (u multiUnit) cost() float64 {
+	item := u.item
+	if item.unitCost > 0 {
+		return float64(item.unitCost)
+	}
+	m := item.multi
+	if m.operationType == "mutation" {
+		return 10
+	}
+	definitions, _ := m.usedFragments([]string{item.body})
+	doc, err := graphql.Parse("query " + item.body + "\n" + strings.Join(definitions, ""))
+	if err != nil || len(doc.Operations) == 0 {
+		return 1
+	}
+	variable := func(name string) interface{} {
+		if v := m.sharedVar(name); v != nil {
+			return v.value
+		}
+		return nil
+	}
+	n := pageSize(u.input("first"), u.input("last"))
+	return math.Max(1, fieldCost(doc, item.operation, n, doc.Operations[0].SelectionSet, variable))
+}
+
+// fieldCost estimates the query cost of a field with the selection set. n is
+// the page size of a connection, or 0.
+func fieldCost(doc *graphql.Document, name string, n float64, selections []graphql.Selection, variable func(string) interface{}) float64 {
+	if len(selections) == 0 {
+		return 0 // scalars and enums
+	}
+	cost := selectionCost(doc, selections, variable)
+	switch {
+	case n > 0:
+		return 2 + n*cost
+	case name == "edges": // counted by the connection
+		return cost
+	}
+	return 1 + cost
+}
+
+// selectionCost estimates the query cost of fields in the selection set.
+// Fragments may be on different types, only the most expensive one is
+// counted.
+func selectionCost(doc *graphql.Document, selections []graphql.Selection, variable func(string) interface{}) float64 {
+	var fields, fragments float64
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *graphql.Field:
+			var first, last interface{}
+			for _, arg := range s.Arguments {
+				value := interface{}(arg.Value)
+				if strings.HasPrefix(arg.Value, "$") {
+					value = variable(strings.TrimSpace(arg.Value[1:]))
+				}
+				switch arg.Name {
+				case "first":
+					first = value
+				case "last":
+					last = value
+				}
+			}
+			fields += fieldCost(doc, s.Name, pageSize(first, last), s.SelectionSet, variable)
+		case *graphql.InlineFragment:
+			fragments = math.Max(fragments, selectionCost(doc, s.SelectionSet, variable))
+		case *graphql.FragmentSpread:
+			if f := doc.Fragment(s.Name); f != nil {
+				fragments = math.Max(fragments, selectionCost(doc, f.SelectionSet, variable))
+			}
+		}
+	}
+	return fields + fragments
+}
+
+// pageSize returns the first number of the values, which are values or
+// source text of the first and last arguments, or 0.
+func pageSize(values ...interface{}) float64 {
+	for _, value := range values {
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			return rv.Float()
+		case reflect.String:
+			if n, err := strconv.ParseFloat(rv.String(), 64); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
@@ -2,6 +2,12 @@ package shopify
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -14,7 +20,7 @@ func TestNewMulti(t *testing.T) {
 	var codes []string
 	var app map[string]string
 
-	gql, args, targets := NewMulti("query").
+	gql, args, targets, err := NewMulti("query").
 		Add("products", "first: Int, reverse: Boolean").
 		Return("ProductConnection { edges { node { id title } } }"). // with fragment
 		In(3, true, 3, false).
@@ -30,6 +36,9 @@ func TestNewMulti(t *testing.T) {
 		Out(&app, "").
 		Self().
 		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if gql != `fragment frag0 on ProductConnection { edges { node { id title } } }
 fragment frag1 on AppInstallation { id launchUrl }
@@ -67,3 +76,464 @@ gql3: currentAppInstallation { ...frag1 }
 	}
 	t.Log("codes =", presentCodes)
 }
+
+func TestMultiArgTypes(t *testing.T) {
+	var titles []string
+	m := NewMulti("mutation")
+	gql, args, _, err := m.
+		Add("metafieldsSet", "metafields: [MetafieldsSetInput!]!").
+		Return("{ userErrors { message } }").
+		In([]KV{{"key": "a"}}).
+		Self().
+		Add("nodes", "ids: [[ID!]]!, first: Int = 10 sortKey: ProductSortKeys = TITLE").
+		Return("{ id }").
+		In([][]string{{"gid://shopify/Product/1"}}, nil, "ID").
+		Out(&titles, ".*.title").
+		Self().
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gql != `mutation($metafields0: [MetafieldsSetInput!]!, $ids1: [[ID!]]!, $first1: Int = 10, $sortKey1: ProductSortKeys = TITLE) {
+gql0: metafieldsSet(metafields: $metafields0) { userErrors { message } }
+gql1: nodes(ids: $ids1, first: $first1, sortKey: $sortKey1) { id }
+}` {
+		t.Error("gql is not correct:", gql)
+	}
+	if toJSON(args) != `["metafields0",[{"key":"a"}],"ids1",[["gid://shopify/Product/1"]],"sortKey1","ID"]` {
+		t.Error("nil input with default value should be omitted:", toJSON(args))
+	}
+
+	gql, args, _, err = NewMulti("query").
+		Add("products", "first: Int = 10, query: String").
+		Return("{ edges { node { id } } }").
+		Self().
+		Do()
+	if err != nil || gql != `query($first0: Int = 10, $query0: String) {
+gql0: products(first: $first0, query: $query0) { edges { node { id } } }
+}` || toJSON(args) != `["query0",null]` {
+		t.Error("optional arguments should not need inputs:", gql, toJSON(args), err)
+	}
+
+	args2, err := parseMultiArgs(`query: String = "a, \"b\"", filter: Filter = {ids: [1, -2.5e3], on: true}`)
+	if err != nil || len(args2) != 2 || args2[0].defaultValue != `"a, \"b\""` ||
+		args2[1].String() != `filter: Filter = {ids: [1, -2.5e3], on: true}` {
+		t.Error("default values are not parsed correctly:", args2, err)
+	}
+
+	for _, argTypes := range []string{
+		"ids: [ID!",
+		"ids: ID!]",
+		"ids [ID]",
+		"ids: ",
+		"first: Int =",
+		`query: String = "a`,
+		"first: Int, first: Int",
+		"1d: ID",
+	} {
+		m := NewMulti("query").Add("nodes", argTypes).Return("{ id }").Self()
+		if m.Err() == nil || m.Len() != 0 {
+			t.Errorf("%q should be invalid", argTypes)
+		}
+		if gql, _, _, err := m.Do(); gql != "" || err != m.Err() {
+			t.Errorf("%q should not generate gql", argTypes)
+		}
+	}
+}
+
+func TestMultiExecute(t *testing.T) {
+	var query string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		query = string(b)
+		w.Write([]byte(`{"data":{
+"gql0":{"userErrors":[],"product":{"id":"gid://shopify/Product/1"}},
+"gql1":{"userErrors":[{"field":["input","title"],"message":"Title can't be blank"}],"product":null},
+"gql2":null,
+"gql3":{"name":"demo"}},
+"errors":[{"message":"Access denied","path":["gql2"]}]}`))
+	}))
+
+	var ids [][]string
+	var name string
+	m := NewMulti("mutation")
+	products := m.Add("productCreate", "input: ProductInput!").
+		Return("{ userErrors { field message } product { id } }").
+		In(KV{"title": "a"}, KV{"title": ""}).
+		Out(&ids, ".product.id")
+	denied := m.Add("customerCreate", "input: CustomerInput!").
+		Return("{ userErrors { field message } customer { id } }").
+		In(KV{})
+	shop := m.Add("shop").Return("{ name }").Out(&name, ".name")
+
+	err := m.Execute(context.Background(), c)
+	var errs MultiErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("execute should return errors of two items: %v", err)
+	}
+	if !strings.Contains(query, "gql1: productCreate") {
+		t.Error("gql should be sent")
+	}
+	if e := products.Errors(); len(e) != 2 || e[0] != nil || e[1] == nil {
+		t.Errorf("only second input of products should fail: %v", e)
+	}
+	var userErrors UserErrors
+	if !errors.As(products.Err(), &userErrors) || userErrors[0].Message != "Title can't be blank" {
+		t.Error("user errors should be matched by alias")
+	}
+	var gqlErrors Errors
+	if !errors.As(denied.Err(), &gqlErrors) || gqlErrors[0].Message != "Access denied" {
+		t.Error("graphql errors should be matched by path")
+	}
+	if shop.Err() != nil || name != "demo" {
+		t.Error("successful item should have results")
+	}
+	if len(ids) != 2 || len(ids[0]) != 1 || ids[0][0] != "gid://shopify/Product/1" {
+		t.Errorf("results of successful input should be set: %v", ids)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	m = NewMulti("query")
+	shop = m.Add("shop").Return("{ name }").Self().Add("shop").Return("{ id }")
+	if err := m.Execute(context.Background(), c); err == nil || shop.Err() == nil {
+		t.Error("failed request should fail every item")
+	}
+
+	c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"gql0":{"name":"demo"},"gql1":null},
+"errors":[{"message":"Internal error"}]}`))
+	}))
+	m = NewMulti("query")
+	shop = m.Add("shop").Return("{ name }")
+	node := m.Add("node", "id: ID!").Return("{ id }").In("gid://shopify/Product/1")
+	m.Execute(context.Background(), c)
+	if shop.Err() != nil || node.Err() == nil {
+		t.Error("errors without path should be set to items without data")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.MaxAliases = 1
+	if err := m.Execute(ctx, c); !errors.Is(shop.Err(), context.Canceled) || !errors.Is(node.Err(), context.Canceled) {
+		t.Error("canceled execution should fail every item:", err)
+	}
+}
+
+func TestMultiChunks(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req.Query)
+		mu.Unlock()
+		data := map[string]interface{}{}
+		for key, value := range req.Variables {
+			alias := "gql" + strings.TrimPrefix(key, "id")
+			data[alias] = map[string]interface{}{"title": "product " + value.(string)}
+		}
+		if strings.Contains(req.Query, "shop") {
+			data["gql5"] = map[string]interface{}{"name": "demo"}
+		}
+		w.Write([]byte(toJSON(map[string]interface{}{"data": data})))
+	}))
+
+	var titles [][]string
+	var last []string
+	var name string
+	m := NewMulti("query")
+	m.MaxAliases = 2
+	m.MaxCost = 3
+	m.Concurrency = 2
+	products := m.Add("product", "id: ID!").
+		Return("Product { title }").
+		In("0", "1", "2", "3", "4").
+		Out(&titles, ".title", &last, ".title")
+	m.Add("shop").Return("{ name }").Cost(3).Out(&name, ".name")
+	if err := m.Execute(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 4 {
+		t.Errorf("should send 4 requests, got %d", len(requests))
+	}
+	for _, req := range requests {
+		if strings.Contains(req, "product(") != strings.Contains(req, "fragment frag0") {
+			t.Errorf("fragment should only be used when needed: %s", req)
+		}
+	}
+	if toJSON(titles) != `[["product 0"],["product 1"],["product 2"],["product 3"],["product 4"]]` {
+		t.Errorf("results are not merged: %s", toJSON(titles))
+	}
+	if toJSON(last) != `["product 4"]` || name != "demo" || products.Err() != nil {
+		t.Errorf("last results are not correct: %v %s", last, name)
+	}
+
+	chunks := m.chunk(m.units())
+	if len(chunks) != 4 || len(chunks[2]) != 1 || chunks[3][0].item.operation != "shop" {
+		t.Error("chunks are not correct")
+	}
+}
+
+func TestWaitThrottle(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"shop":{"name":"demo"}},"extensions":{"cost":{"requestedQueryCost":1,"actualQueryCost":1,
+"throttleStatus":{"maximumAvailable":1000,"currentlyAvailable":10,"restoreRate":1000}}}}`))
+	}))
+	if c.ThrottleStatus() != nil {
+		t.Error("throttle status should be unknown")
+	}
+	if err := c.New("{ shop { name } }").Do(); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.ThrottleStatus(); s == nil || s.MaximumAvailable != 1000 {
+		t.Fatal("throttle status should be updated")
+	}
+	start := time.Now()
+	if _, err := c.waitThrottle(context.Background(), 110); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 90*time.Millisecond {
+		t.Error("should wait for restored cost")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.waitThrottle(ctx, 1000); err != context.DeadlineExceeded {
+		t.Error("wait should be canceled")
+	}
+
+	c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"shop":{"name":"demo"}},"extensions":{"cost":{"requestedQueryCost":1,"actualQueryCost":1,
+"throttleStatus":{"maximumAvailable":1000,"currentlyAvailable":500,"restoreRate":0.001}}}}`))
+	}))
+	c.New("{ shop { name } }").Do()
+	reserved, _ := c.waitThrottle(context.Background(), 100)
+	if reserved != 100 {
+		t.Fatal("cost should be reserved")
+	}
+	c.New("{ shop { name } }").Do()
+	if s := c.ThrottleStatus(); s.CurrentlyAvailable > 401 {
+		t.Error("reserved cost should be subtracted from throttle status:", s.CurrentlyAvailable)
+	}
+	c.updateThrottle(nil, reserved)
+	if c.throttleReserved != 0 {
+		t.Error("reserved cost should be released")
+	}
+}
+
+func TestMultiCost(t *testing.T) {
+	m := NewMulti("query").Var("n", "Int!", 5).
+		Fragment("ProductFields", "Product { title images(first: $n) { edges { node { url } } } }")
+	for _, test := range []struct {
+		item *MultiItem
+		cost float64
+	}{
+		{m.Add("shop").Return("{ name }"), 1},
+		{m.Add("product", "id: ID!").Return("{ title }").In("1"), 1},
+		{m.Add("products", "first: Int!").Return("{ edges { node { ...ProductFields } } }").In(10), 2 + 10*(1+2+5*1)},
+		{m.Add("nodes", "ids: [ID!]!").Return("... on Product { id } ... on Collection { products(first: 3) { edges { node { id } } } }").In([]string{}), 1 + 2 + 3*1},
+		{m.Add("node", "id: ID!").Return("{ id }").In("1").Cost(7), 7},
+		{NewMulti("mutation").Add("productDelete", "input: ProductDeleteInput!").Return("{ deletedProductId }").In(KV{}), 10},
+	} {
+		m := test.item.multi
+		m.units()
+		if cost := (multiUnit{test.item, 0, 0}).cost(); cost != test.cost {
+			t.Errorf("cost of %s should be %v, got %v", test.item.operation, test.cost, cost)
+		}
+	}
+}
+
+func TestMultiValidate(t *testing.T) {
+	var ids []string
+	var id string
+	for name, m := range map[string]*Multi{
+		"operation type": NewMulti("subscription").Add("shop").Return("{ id }").Self(),
+		"no operations":  NewMulti("query"),
+		"mixed types":    NewMulti("query").Add("mutation productCreate").Return("{ id }").Self(),
+		"empty body":     NewMulti("query").Add("shop").Return("{ }").Self(),
+		"no body":        NewMulti("query").Add("shop").Self(),
+		"arity":          NewMulti("query").Add("product", "id: ID!, x: Int").Return("{ id }").In("1", 2, "3").Self(),
+		"no inputs":      NewMulti("query").Add("product", "id: ID!").Return("{ id }").Self(),
+		"no arguments":   NewMulti("query").Add("shop").Return("{ id }").In(1).Self(),
+		"odd targets":    NewMulti("query").Add("shop").Return("{ id }").Out(&ids).Self(),
+		"path":           NewMulti("query").Add("shop").Return("{ id }").Out(&ids, 1).Self(),
+		"pointer":        NewMulti("query").Add("shop").Return("{ id }").Out(id, ".id").Self(),
+	} {
+		if _, _, _, err := m.Do(); !errors.Is(err, ErrInvalidMulti) {
+			t.Errorf("%s: should be invalid, got %v", name, err)
+		}
+		if err := m.Execute(context.Background(), nil); !errors.Is(err, ErrInvalidMulti) {
+			t.Errorf("%s: should not be executed", name)
+		}
+	}
+}
+
+func TestMultiAliasKeyBy(t *testing.T) {
+	var query string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		query = string(b)
+		w.Write([]byte(`{"data":{
+"product0":{"id":"gid://shopify/Product/1","title":"a"},
+"product1":{"id":"gid://shopify/Product/2","title":"b"},
+"variantA":{"id":"gid://shopify/ProductVariant/1","sku":"A"},
+"variantB":{"id":"gid://shopify/ProductVariant/2","sku":"B"},
+"gql4":{"id":"gid://shopify/Order/1"}}}`))
+	}))
+
+	var titles map[string]string
+	var skus map[int]string
+	var lastTitle string
+	var order string
+	m := NewMulti("query")
+	m.Add("product", "id: ID!").Return("{ id title }").
+		In("gid://shopify/Product/1", "gid://shopify/Product/2").
+		Alias("product").KeyBy("id").
+		Out(&titles, ".title", &lastTitle, ".title")
+	m.Add("productVariant", "id: ID!, n: Int").Return("{ id sku }").
+		In("gid://shopify/ProductVariant/1", 1, "gid://shopify/ProductVariant/2", 2).
+		Alias("variantA", "variantB").KeyBy("n").
+		Out(&skus, ".sku")
+	m.Add("order", "id: ID!").Return("{ id }").In("gid://shopify/Order/1").Out(&order, ".id")
+	if err := m.Execute(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `product1: product(id: $id1)`) || !strings.Contains(query, `variantB: productVariant(id: $id3, n: $n3)`) ||
+		!strings.Contains(query, `gql4: order(id: $id4)`) {
+		t.Errorf("aliases are not correct: %s", query)
+	}
+	if titles["gid://shopify/Product/1"] != "a" || titles["gid://shopify/Product/2"] != "b" || lastTitle != "b" {
+		t.Errorf("results should be keyed by id: %v", titles)
+	}
+	if skus[1] != "A" || skus[2] != "B" || order != "gid://shopify/Order/1" {
+		t.Errorf("results should be keyed by n: %v", skus)
+	}
+
+	var app map[string]string
+	gql, _, targets, err := NewMulti("query").Add("currentAppInstallation").Return("{ id }").Out(&app, "").Self().Do()
+	if err != nil || !strings.Contains(gql, "gql0: currentAppInstallation") || toJSON(targets) != `[null,"gql0"]` {
+		t.Error("map destination without KeyBy should get the result")
+	}
+
+	var ids map[bool]string
+	for name, m := range map[string]*Multi{
+		"duplicate": NewMulti("query").Add("shop").Return("{ id }").Alias("a").Self().Add("order", "id: ID!").Return("{ id }").In(1).Alias("a").Self(),
+		"name":      NewMulti("query").Add("shop").Return("{ id }").Alias("a-b").Self(),
+		"count":     NewMulti("query").Add("order", "id: ID!").Return("{ id }").In(1, 2, 3).Alias("a", "b").Self(),
+		"argument":  NewMulti("query").Add("order", "id: ID!").Return("{ id }").In(1).KeyBy("x").Out(&ids, ".id").Self(),
+		"key type":  NewMulti("query").Add("order", "id: ID!").Return("{ id }").In(1).KeyBy("id").Out(&ids, ".id").Self(),
+	} {
+		if _, _, _, err := m.Do(); !errors.Is(err, ErrInvalidMulti) {
+			t.Errorf("%s: should be invalid, got %v", name, err)
+		}
+	}
+}
+
+func TestMultiSharedVars(t *testing.T) {
+	m := NewMulti("mutation").Var("locationId", "ID!", "gid://shopify/Location/1")
+	m.Var("unused", "String", "x")
+	m.Add("inventoryActivate", "inventoryItemId: ID!, locationId: $locationId").
+		Return("InventoryActivatePayload { userErrors { message } }").
+		In("gid://shopify/InventoryItem/1", "gid://shopify/InventoryItem/2")
+	m.Add("inventoryActivate", "inventoryItemId: ID!, locationId: $locationId, available: Int").
+		Return("InventoryActivatePayload { userErrors { message } }").
+		In("gid://shopify/InventoryItem/3", 5)
+	gql, args, _, err := m.Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gql != `fragment frag0 on InventoryActivatePayload { userErrors { message } }
+mutation($inventoryItemId0: ID!, $locationId: ID!, $inventoryItemId1: ID!, $inventoryItemId2: ID!, $available2: Int) {
+gql0: inventoryActivate(inventoryItemId: $inventoryItemId0, locationId: $locationId) { ...frag0 }
+gql1: inventoryActivate(inventoryItemId: $inventoryItemId1, locationId: $locationId) { ...frag0 }
+gql2: inventoryActivate(inventoryItemId: $inventoryItemId2, locationId: $locationId, available: $available2) { ...frag0 }
+}` {
+		t.Error("gql is not correct:", gql)
+	}
+	if toJSON(args) != `["inventoryItemId0","gid://shopify/InventoryItem/1","locationId","gid://shopify/Location/1","inventoryItemId1","gid://shopify/InventoryItem/2","inventoryItemId2","gid://shopify/InventoryItem/3","available2",5]` {
+		t.Error("args are not correct:", toJSON(args))
+	}
+
+	gql, args, _, err = NewMulti("query").Var("n", "Int = 10", nil).Var("q", "String", nil).
+		Add("products", "first: $n, query: $q").Return("{ edges { node { id } } }").Self().
+		Do()
+	if err != nil || !strings.HasPrefix(gql, "query($n: Int = 10, $q: String) {") || toJSON(args) != `["q",null]` {
+		t.Error("nil shared variable with default value should be omitted:", gql, toJSON(args), err)
+	}
+
+	for name, m := range map[string]*Multi{
+		"undeclared": NewMulti("query").Add("product", "id: $id").Return("{ id }").Self(),
+		"duplicate":  NewMulti("query").Var("id", "ID!", 1).Var("id", "ID!", 2).Add("product", "id: $id").Return("{ id }").Self(),
+		"type":       NewMulti("query").Var("id", "[ID!", 1).Add("product", "id: $id").Return("{ id }").Self(),
+		"conflict":   NewMulti("query").Var("id0", "ID!", 1).Add("product", "id: ID!").Return("{ id }").In(2).Self(),
+	} {
+		if _, _, _, err := m.Do(); err == nil {
+			t.Errorf("%s: should be invalid", name)
+		}
+	}
+}
+
+func TestMultiBodies(t *testing.T) {
+	m := NewMulti("query").Var("withTags", "Boolean!", true).
+		Fragment("ProductFields", "Product { id title ...VariantFields }").
+		Fragment("VariantFields", "Product { variants(first: 1) { edges { node { sku } } } }").
+		Fragment("Unused", "Order { id }")
+	m.Add("nodes", "ids: [ID!]!").
+		Return(`... on Product { ...ProductFields tags @include(if: $withTags) } ... on Collection { title }`).
+		In([]string{"gid://shopify/Product/1", "gid://shopify/Collection/1"})
+	m.Add("product", "id: ID!").
+		Return("Product @skip(if: false) { ...ProductFields }").
+		In("gid://shopify/Product/2")
+	m.Add("collection", "id: ID!").Return("id title").In("gid://shopify/Collection/2")
+	m.Add("productVariant", "id: ID!").Return("{ id }").In("gid://shopify/ProductVariant/1")
+	gql, _, _, err := m.Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gql != `fragment frag0 on Product { ...ProductFields }
+fragment ProductFields on Product { id title ...VariantFields }
+fragment VariantFields on Product { variants(first: 1) { edges { node { sku } } } }
+query($ids0: [ID!]!, $id1: ID!, $id2: ID!, $id3: ID!, $withTags: Boolean!) {
+gql0: nodes(ids: $ids0) { __typename ... on Product { ...ProductFields tags @include(if: $withTags) } ... on Collection { title } }
+gql1: product(id: $id1) { ...frag0 @skip(if: false) }
+gql2: collection(id: $id2) { id title }
+gql3: productVariant(id: $id3) { id }
+}` {
+		t.Error("gql is not correct:", gql)
+	}
+
+	for name, m := range map[string]*Multi{
+		"unbalanced": NewMulti("query").Add("shop").Return("{ id { name }").Self(),
+		"trailing":   NewMulti("query").Add("shop").Return("{ id } name").Self(),
+		"string":     NewMulti("query").Add("shop").Return(`{ id(x: "a) }`).Self(),
+		"undefined":  NewMulti("query").Add("shop").Return("{ ...ShopFields }").Self(),
+		"no type":    NewMulti("query").Fragment("ShopFields", "{ id }").Add("shop").Return("{ id }").Self(),
+		"fragment":   NewMulti("query").Fragment("frag0", "Shop { id }").Add("shop").Return("{ id }").Self(),
+		"field type": NewMulti("query").Add("shop").Return("edges { node { id } }").Self(),
+		"lower type": NewMulti("query").Fragment("ShopFields", "shop { id }").Add("shop").Return("{ ...ShopFields }").Self(),
+	} {
+		if _, _, _, err := m.Do(); err == nil {
+			t.Errorf("%s: should be invalid", name)
+		}
+	}
+
+	var nodes []TypedResult
+	json.Unmarshal([]byte(`[{"__typename":"Product","title":"a"},null,{"__typename":"Collection","title":"b"}]`), &nodes)
+	var product struct {
+		Title string `json:"title"`
+	}
+	if len(nodes) != 3 || nodes[0].Typename != "Product" || nodes[1].Typename != "" || nodes[2].Typename != "Collection" {
+		t.Fatal("typed results are not correct")
+	}
+	if err := nodes[0].Decode(&product); err != nil || product.Title != "a" {
+		t.Error("typed result should be decoded")
+	}
+	if toJSON(nodes) != `[{"__typename":"Product","title":"a"},null,{"__typename":"Collection","title":"b"}]` {
+		t.Error("typed results should be encoded as is")
+	}
+}
@@ -1,7 +1,19 @@
 package shopify
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -9,6 +21,33 @@ import (
 var (
 	Oauth2StaticTokenSource = oauth2.StaticTokenSource
 	Oauth2NewClient         = oauth2.NewClient
+	Oauth2HTTPClient        = oauth2.HTTPClient
+
+	ErrTokenExpired  = errors.New("access token expired")
+	ErrTokenNotFound = errors.New("access token not found")
+
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleRequest     = errors.New("stale request")
+)
+
+const defaultAppProxyMaxAge = 5 * time.Minute
+
+// Tokens expiring within this duration are treated as expired, so that they
+// do not expire before requests arrive, like expiryDelta of x/oauth2.
+const tokenExpiryDelta = 10 * time.Second
+
+const (
+	// Offline access tokens never expire and are not tied to any user.
+	OfflineAccess AccessMode = "offline"
+
+	// Online access tokens expire and are tied to the staff member who
+	// authorized the app.
+	OnlineAccess AccessMode = "online"
+
+	// Expiring offline access tokens are not tied to any user. They expire
+	// and are refreshed with a refresh token which is rotated on each
+	// refresh. See RefreshingTokenSource.
+	ExpiringOfflineAccess AccessMode = "offline-expiring"
 )
 
 type (
@@ -17,16 +56,277 @@ type (
 	Oauth2Token     = oauth2.Token
 	Oauth2Transport = oauth2.Transport
 
+	Oauth2AuthCodeOption = oauth2.AuthCodeOption
+	Oauth2RetrieveError  = oauth2.RetrieveError
+	Oauth2TokenSource    = oauth2.TokenSource
+
+	// Access mode of a token, either OfflineAccess, OnlineAccess or
+	// ExpiringOfflineAccess.
+	AccessMode string
+
+	// Extra fields in the access token response of Shopify.
+	Oauth2TokenExtra struct {
+		Scope                 string          `json:"scope"`
+		ExpiresIn             int             `json:"expires_in"`
+		RefreshTokenExpiresIn int             `json:"refresh_token_expires_in"`
+		AssociatedUserScope   string          `json:"associated_user_scope"`
+		AssociatedUser        *AssociatedUser `json:"associated_user"`
+	}
+
+	// Staff member an online access token belongs to.
+	AssociatedUser struct {
+		Id            int64  `json:"id"`
+		FirstName     string `json:"first_name"`
+		LastName      string `json:"last_name"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		AccountOwner  bool   `json:"account_owner"`
+		Locale        string `json:"locale"`
+		Collaborator  bool   `json:"collaborator"`
+	}
+
+	// AppProxyVerifier verifies the signature of storefront requests
+	// forwarded by an app proxy.
+	AppProxyVerifier struct {
+		ClientSecret string // API secret key of the app
+
+		// Reject requests with a timestamp older than this, defaults to 5
+		// minutes.
+		MaxAge time.Duration
+
+		// Called when verification fails in Middleware. If nil, 401
+		// Unauthorized is written.
+		OnError func(w http.ResponseWriter, r *http.Request, err error)
+	}
+
 	transport struct {
 		base *Oauth2Transport
 	}
 )
 
+// Oauth2ShopEndpoint returns the authorize and access token urls of a shop.
+// The shop is normalized with NormalizeShop.
+func Oauth2ShopEndpoint(shop string) (endpoint Oauth2Endpoint, err error) {
+	shop, err = NormalizeShop(shop)
+	if err != nil {
+		return
+	}
+	endpoint = Oauth2Endpoint{
+		AuthURL:   fmt.Sprintf("https://%s.myshopify.com/admin/oauth/authorize", shop),
+		TokenURL:  fmt.Sprintf("https://%s.myshopify.com/admin/oauth/access_token", shop),
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return
+}
+
+// NewOauth2Config creates a config of the app credentials for a shop.
+func NewOauth2Config(shop, clientID, clientSecret, redirectURL string, scopes ...string) (*Oauth2Config, error) {
+	endpoint, err := Oauth2ShopEndpoint(shop)
+	if err != nil {
+		return nil, err
+	}
+	return &Oauth2Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}, nil
+}
+
+// ParseOauth2TokenExtra returns Shopify's extra fields of a token obtained
+// from the token endpoint. Fields are empty if the token is loaded from JSON.
+func ParseOauth2TokenExtra(token *Oauth2Token) *Oauth2TokenExtra {
+	values := map[string]interface{}{}
+	for _, key := range []string{
+		"scope", "expires_in", "refresh_token_expires_in",
+		"associated_user_scope", "associated_user",
+	} {
+		if value := token.Extra(key); value != nil {
+			values[key] = value
+		}
+	}
+	extra := new(Oauth2TokenExtra)
+	b, _ := json.Marshal(values)
+	json.Unmarshal(b, extra)
+	return extra
+}
+
+// Scopes returns the granted access scopes.
+func (extra Oauth2TokenExtra) Scopes() []string {
+	return splitScopes(extra.Scope)
+}
+
+// AccessModeOf returns the access mode of a token. A token is online if the
+// token response has an associated user, or, for tokens loaded from JSON, if
+// it expires and can't be refreshed. A token with a refresh token is an
+// expiring offline token.
+func AccessModeOf(token *Oauth2Token) AccessMode {
+	if token.RefreshToken != "" {
+		return ExpiringOfflineAccess
+	}
+	if ParseOauth2TokenExtra(token).AssociatedUser != nil || !token.Expiry.IsZero() {
+		return OnlineAccess
+	}
+	return OfflineAccess
+}
+
+// PickOauth2Token returns the first unexpired token of the access mode.
+func PickOauth2Token(mode AccessMode, tokens ...*Oauth2Token) (*Oauth2Token, error) {
+	err := ErrTokenNotFound
+	for _, token := range tokens {
+		if token == nil || AccessModeOf(token) != mode {
+			continue
+		}
+		if tokenExpired(token) {
+			err = ErrTokenExpired
+			continue
+		}
+		return token, nil
+	}
+	return nil, err
+}
+
+// Create a new client with shop name and a static access token.
+func NewClientWithToken(shop string, token *Oauth2Token) *Client {
+	return NewClientWithTokenSource(shop, Oauth2StaticTokenSource(token))
+}
+
+// Create a new client with shop name and a token source. The token source is
+// called before each request, so it should cache the token.
+func NewClientWithTokenSource(shop string, src Oauth2TokenSource) *Client {
+	return NewClient(shop, &http.Client{
+		Transport: &Oauth2Transport{Source: src},
+	})
+}
+
+// AuthCodeOptions returns the options of Oauth2Config.AuthCodeURL to request
+// a token of the access mode.
+func (mode AccessMode) AuthCodeOptions() []Oauth2AuthCodeOption {
+	if mode == OnlineAccess {
+		return []Oauth2AuthCodeOption{oauth2.SetAuthURLParam("grant_options[]", "per-user")}
+	}
+	return nil
+}
+
+// ExchangeOptions returns the options of Oauth2Config.Exchange to obtain a
+// token of the access mode.
+func (mode AccessMode) ExchangeOptions() []Oauth2AuthCodeOption {
+	if mode == ExpiringOfflineAccess {
+		return []Oauth2AuthCodeOption{oauth2.SetAuthURLParam("expiring", "1")}
+	}
+	return nil
+}
+
+// Verify checks the signature and timestamp of the query of an app proxy
+// request. ErrNoClientSecret is returned if ClientSecret is empty.
+func (v *AppProxyVerifier) Verify(query url.Values) error {
+	if v.ClientSecret == "" {
+		return ErrNoClientSecret
+	}
+	sig, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || len(sig) == 0 {
+		return ErrInvalidSignature
+	}
+	var keys []string
+	for key := range query {
+		if key != "signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var message string
+	for _, key := range keys {
+		message += key + "=" + strings.Join(query[key], ",")
+	}
+	mac := hmac.New(sha256.New, []byte(v.ClientSecret))
+	mac.Write([]byte(message))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultAppProxyMaxAge
+	}
+	timestamp, err := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+	if err != nil {
+		return ErrStaleRequest
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > maxAge || d < -maxAge {
+		return ErrStaleRequest
+	}
+	return nil
+}
+
+// Middleware verifies app proxy requests, removes the signature from the
+// query and puts the shop, logged in customer id and path prefix into the
+// request context.
+func (v *AppProxyVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if err := v.Verify(query); err != nil {
+			v.fail(w, r, err)
+			return
+		}
+		shop, err := ShopFromDomain(query.Get("shop"))
+		if err != nil {
+			v.fail(w, r, err)
+			return
+		}
+		query.Del("signature")
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+		ctx := context.WithValue(r.Context(), contextKeyShop, shop)
+		ctx = context.WithValue(ctx, contextKeyCustomerId, query.Get("logged_in_customer_id"))
+		ctx = context.WithValue(ctx, contextKeyPathPrefix, query.Get("path_prefix"))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (v *AppProxyVerifier) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if v.OnError != nil {
+		v.OnError(w, r, err)
+		return
+	}
+	writeVerifyError(w, err)
+}
+
+// CustomerIdFromContext returns the logged in customer id of an app proxy
+// request, or an empty string if no customer is logged in.
+func CustomerIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyCustomerId).(string)
+	return id
+}
+
+// PathPrefixFromContext returns the path prefix of an app proxy request, like
+// "/apps/my-app".
+func PathPrefixFromContext(ctx context.Context) string {
+	prefix, _ := ctx.Value(contextKeyPathPrefix).(string)
+	return prefix
+}
+
 func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	token, err := t.base.Source.Token()
 	if err != nil {
 		return nil, err
 	}
+	if tokenExpired(token) {
+		return nil, ErrTokenExpired
+	}
 	r.Header.Add("X-Shopify-Access-Token", token.AccessToken)
 	return t.base.RoundTrip(r)
 }
+
+func tokenExpired(token *Oauth2Token) bool {
+	return !token.Expiry.IsZero() && !token.Expiry.After(time.Now().Add(tokenExpiryDelta))
+}
+
+func splitScopes(scope string) (scopes []string) {
+	for _, s := range strings.Split(scope, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return
+}
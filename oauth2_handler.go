@@ -0,0 +1,244 @@
+package shopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidHMAC  = errors.New("invalid hmac")
+	ErrInvalidState = errors.New("invalid oauth state")
+)
+
+const defaultStateCookieName = "shopify_oauth_state"
+
+type (
+	// InstallHandler provides the begin and callback handlers of the OAuth
+	// install flow of a Shopify app.
+	InstallHandler struct {
+		// App credentials, scopes and redirect url. The endpoint is
+		// generated for each shop by Oauth2ShopEndpoint, so it can be left
+		// empty.
+		Config *Oauth2Config
+
+		// Request offline (default), online or expiring offline access
+		// tokens.
+		AccessMode AccessMode
+
+		// Name of the cookie to store the state nonce, defaults to
+		// "shopify_oauth_state".
+		CookieName string
+
+		// Context of refreshing expiring offline tokens of the clients
+		// passed to OnInstall, which lives as long as the clients. Defaults
+		// to context.Background().
+		RefreshContext context.Context
+
+		// Called with the new token after an expiring offline token of a
+		// client passed to OnInstall is refreshed. Refresh tokens are
+		// rotated on each refresh, so the token should be saved.
+		OnRefresh func(shop string, token *Oauth2Token) error
+
+		// Called once the access token is obtained. The client is ready to
+		// make requests to the shop. Expiring offline tokens are refreshed
+		// by the client when they expire.
+		OnInstall func(w http.ResponseWriter, r *http.Request, token *Oauth2Token, client *Client)
+
+		// Called when the flow fails. If nil, a plain text error is written.
+		OnError func(w http.ResponseWriter, r *http.Request, err error)
+	}
+)
+
+// Begin returns a handler that redirects the merchant to the consent page of
+// the shop in the "shop" query param. A random nonce is stored in a cookie and
+// sent as the state.
+func (h *InstallHandler) Begin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		parseShop := NormalizeShop // user input
+		if query.Get("hmac") != "" {
+			if err := h.verifyHMAC(query); err != nil {
+				h.fail(w, r, err)
+				return
+			}
+			parseShop = ShopFromDomain
+		}
+		shop, err := parseShop(query.Get("shop"))
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		conf, err := h.shopConfig(shop)
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		state, err := newNonce()
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.cookieName(),
+			Value:    state,
+			Path:     "/",
+			MaxAge:   600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, conf.AuthCodeURL(state, h.AccessMode.AuthCodeOptions()...), http.StatusFound)
+	})
+}
+
+// Callback returns a handler for the redirect url. It verifies the hmac, the
+// shop domain and the state, exchanges the code for an access token and
+// calls OnInstall.
+func (h *InstallHandler) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if err := h.verifyHMAC(query); err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		shop, err := ShopFromDomain(query.Get("shop"))
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		cookie, err := r.Cookie(h.cookieName())
+		state := query.Get("state")
+		if err != nil || state == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			h.fail(w, r, ErrInvalidState)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:   h.cookieName(),
+			Path:   "/",
+			MaxAge: -1,
+		})
+		conf, err := h.shopConfig(shop)
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		token, err := conf.Exchange(r.Context(), query.Get("code"), h.AccessMode.ExchangeOptions()...)
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		client, err := h.newClient(conf, shop, token)
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		if h.OnInstall != nil {
+			h.OnInstall(w, r, token, client)
+		}
+	})
+}
+
+// newClient returns a client of the token, which refreshes it with
+// RefreshContext if it has a refresh token.
+func (h *InstallHandler) newClient(conf *Oauth2Config, shop string, token *Oauth2Token) (*Client, error) {
+	if token.RefreshToken == "" {
+		return NewClientWithToken(shop, token), nil
+	}
+	refreshCtx := h.RefreshContext
+	if refreshCtx == nil {
+		refreshCtx = context.Background()
+	}
+	src, err := NewRefreshingTokenSource(refreshCtx, conf, shop, token, func(token *Oauth2Token) error {
+		if h.OnRefresh == nil {
+			return nil
+		}
+		return h.OnRefresh(shop, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithTokenSource(shop, src), nil
+}
+
+func (h *InstallHandler) cookieName() string {
+	if h.CookieName == "" {
+		return defaultStateCookieName
+	}
+	return h.CookieName
+}
+
+func (h *InstallHandler) shopConfig(shop string) (*Oauth2Config, error) {
+	c := h.Config
+	return NewOauth2Config(shop, c.ClientID, c.ClientSecret, c.RedirectURL, c.Scopes...)
+}
+
+func (h *InstallHandler) verifyHMAC(query url.Values) error {
+	if h.Config.ClientSecret == "" {
+		return ErrNoClientSecret
+	}
+	if !VerifyOauth2HMAC(query, h.Config.ClientSecret) {
+		return ErrInvalidHMAC
+	}
+	return nil
+}
+
+func (h *InstallHandler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if h.OnError != nil {
+		h.OnError(w, r, err)
+		return
+	}
+	status := http.StatusInternalServerError
+	switch err {
+	case ErrInvalidShop:
+		status = http.StatusBadRequest
+	case ErrInvalidHMAC, ErrInvalidState:
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// VerifyOauth2HMAC reports whether the hmac query param of a request from
+// Shopify (app url or redirect url) is signed with the app's client secret.
+// It returns false if secret is empty.
+func VerifyOauth2HMAC(query url.Values, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	sig, err := hex.DecodeString(query.Get("hmac"))
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+	var keys []string
+	for key := range query {
+		if key == "hmac" || key == "signature" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+strings.Join(query[key], ","))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(pairs, "&")))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
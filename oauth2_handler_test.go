@@ -0,0 +1,214 @@
+package shopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const testSecret = "shpss_test"
+
+// rewriteTransport sends every request to the test server.
+type rewriteTransport struct {
+	url *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.url.Scheme
+	r.URL.Host = t.url.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newTestHTTPClient(t *testing.T, handler http.Handler) *http.Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	u, _ := url.Parse(ts.URL)
+	return &http.Client{Transport: rewriteTransport{u}}
+}
+
+// newTestClient returns a client of shop "demo" sending requests to handler.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	c := NewClientWithToken("demo", &Oauth2Token{AccessToken: "shpat_test"})
+	c.httpClient.Transport.(*transport).base.Base = newTestHTTPClient(t, handler).Transport
+	return c
+}
+
+func signQuery(query url.Values) url.Values {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+strings.Join(query[key], ","))
+	}
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(strings.Join(pairs, "&")))
+	query.Set("hmac", hex.EncodeToString(mac.Sum(nil)))
+	return query
+}
+
+func TestInstallHandler(t *testing.T) {
+	tokenServer := newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/oauth/access_token" || r.FormValue("code") != "thecode" ||
+			r.FormValue("client_secret") != testSecret {
+			http.Error(w, "bad request", 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"shpat_test","scope":"read_products"}`))
+	}))
+
+	var installed *Client
+	var token *Oauth2Token
+	h := &InstallHandler{
+		Config: &Oauth2Config{
+			ClientID:     "clientid",
+			ClientSecret: testSecret,
+			Scopes:       []string{"read_products"},
+			RedirectURL:  "https://app.example.com/callback",
+		},
+		OnInstall: func(w http.ResponseWriter, r *http.Request, t *Oauth2Token, c *Client) {
+			token, installed = t, c
+		},
+	}
+
+	w := httptest.NewRecorder()
+	h.Begin().ServeHTTP(w, httptest.NewRequest("GET", "/install?shop=evil.com", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid shop should be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.Begin().ServeHTTP(w, httptest.NewRequest("GET", "/install?shop=demo.myshopify.com", nil))
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	if loc == nil || loc.Host != "demo.myshopify.com" || loc.Path != "/admin/oauth/authorize" {
+		t.Fatalf("wrong redirect: %s", w.Header().Get("Location"))
+	}
+	if loc.Query().Get("grant_options[]") != "" {
+		t.Error("offline access should not request per-user grant")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != loc.Query().Get("state") {
+		t.Fatal("state cookie should match state param")
+	}
+
+	callback := func(query url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/callback?"+query.Encode(), nil)
+		r = r.WithContext(context.WithValue(r.Context(), oauth2.HTTPClient, tokenServer))
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		h.Callback().ServeHTTP(w, r)
+		return w
+	}
+
+	query := url.Values{"code": {"thecode"}, "shop": {"demo.myshopify.com"}, "state": {cookies[0].Value}}
+	query.Set("timestamp", "1337178173")
+	tampered := signQuery(url.Values{"code": {"thecode"}, "shop": {"demo.myshopify.com"}, "state": {cookies[0].Value}})
+	tampered.Set("shop", "other.myshopify.com")
+	if w := callback(tampered); w.Code != http.StatusForbidden {
+		t.Errorf("tampered request should be rejected, got %d", w.Code)
+	}
+	if w := callback(signQuery(url.Values{"code": {"thecode"}, "shop": {"https://demo.myshopify.com"}, "state": {cookies[0].Value}})); w.Code != http.StatusBadRequest {
+		t.Errorf("shop which is not a domain should be rejected, got %d", w.Code)
+	}
+	badState := signQuery(url.Values{"code": {"thecode"}, "shop": {"demo.myshopify.com"}, "state": {"other"}})
+	if w := callback(badState); w.Code != http.StatusForbidden {
+		t.Errorf("wrong state should be rejected, got %d", w.Code)
+	}
+	if w := callback(signQuery(query)); w.Code != http.StatusOK {
+		t.Fatalf("callback failed: %d %s", w.Code, w.Body.String())
+	}
+	if token == nil || token.AccessToken != "shpat_test" {
+		t.Error("token is not correct")
+	}
+	if installed == nil || installed.Shop != "demo" {
+		t.Error("client is not correct")
+	}
+
+	h.Config.ClientSecret = ""
+	if w := callback(query); w.Code != http.StatusInternalServerError {
+		t.Errorf("callback should be rejected without client secret, got %d", w.Code)
+	}
+	h.Config.ClientSecret = testSecret
+
+	h.AccessMode = OnlineAccess
+	w = httptest.NewRecorder()
+	h.Begin().ServeHTTP(w, httptest.NewRequest("GET", "/install?shop=demo.myshopify.com", nil))
+	loc, _ = url.Parse(w.Header().Get("Location"))
+	if loc.Query().Get("grant_options[]") != "per-user" {
+		t.Error("online access should request per-user grant")
+	}
+}
+
+func TestInstallHandlerExpiringOfflineAccess(t *testing.T) {
+	refreshes := 0
+	tokenServer := newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("code") == "thecode" && r.FormValue("expiring") == "1" {
+			w.Write([]byte(`{"access_token":"shpat_0","expires_in":30,"refresh_token":"shprt_0","scope":"read_products"}`))
+			return
+		}
+		var req refreshTokenRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.GrantType != "refresh_token" || req.RefreshToken != "shprt_0" {
+			http.Error(w, "bad request", 400)
+			return
+		}
+		refreshes++
+		w.Write([]byte(`{"access_token":"shpat_1","expires_in":3600,"refresh_token":"shprt_1","scope":"read_products"}`))
+	}))
+
+	var installed *Client
+	var saved []*Oauth2Token
+	h := &InstallHandler{
+		Config: &Oauth2Config{
+			ClientID:     "clientid",
+			ClientSecret: testSecret,
+			RedirectURL:  "https://app.example.com/callback",
+		},
+		AccessMode:     ExpiringOfflineAccess,
+		RefreshContext: context.WithValue(context.Background(), oauth2.HTTPClient, tokenServer),
+		OnRefresh: func(shop string, token *Oauth2Token) error {
+			if shop != "demo" {
+				t.Errorf("wrong shop: %s", shop)
+			}
+			saved = append(saved, token)
+			return nil
+		},
+		OnInstall: func(w http.ResponseWriter, r *http.Request, t *Oauth2Token, c *Client) {
+			installed = c
+		},
+	}
+
+	query := signQuery(url.Values{"code": {"thecode"}, "shop": {"demo.myshopify.com"}, "state": {"nonce"}})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), oauth2.HTTPClient, tokenServer))
+	r := httptest.NewRequest("GET", "/callback?"+query.Encode(), nil).WithContext(ctx)
+	r.AddCookie(&http.Cookie{Name: defaultStateCookieName, Value: "nonce"})
+	w := httptest.NewRecorder()
+	h.Callback().ServeHTTP(w, r)
+	cancel()
+	if w.Code != http.StatusOK || installed == nil {
+		t.Fatalf("callback failed: %d %s", w.Code, w.Body.String())
+	}
+
+	token, err := installed.httpClient.Transport.(*transport).base.Source.Token()
+	if err != nil || token.AccessToken != "shpat_1" {
+		t.Fatalf("token should be refreshed after the request: %v", err)
+	}
+	if refreshes != 1 || len(saved) != 1 || saved[0].RefreshToken != "shprt_1" {
+		t.Error("refreshed token should be passed to OnRefresh")
+	}
+}
@@ -0,0 +1,179 @@
+package shopify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNewOauth2Config(t *testing.T) {
+	for _, shop := range []string{"demo", "demo.myshopify.com"} {
+		conf, err := NewOauth2Config(shop, "id", "secret", "https://app.example.com/callback", "read_products")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.Endpoint.AuthURL != "https://demo.myshopify.com/admin/oauth/authorize" ||
+			conf.Endpoint.TokenURL != "https://demo.myshopify.com/admin/oauth/access_token" {
+			t.Errorf("wrong endpoint: %+v", conf.Endpoint)
+		}
+	}
+	for _, shop := range []string{"", "evil.com/x?", "demo.myshopify.com.evil.com", "-demo"} {
+		if _, err := NewOauth2Config(shop, "id", "secret", ""); err != ErrInvalidShop {
+			t.Errorf("%q should be invalid", shop)
+		}
+	}
+}
+
+func TestParseOauth2TokenExtra(t *testing.T) {
+	token := (&Oauth2Token{AccessToken: "shpat_test"}).WithExtra(map[string]interface{}{
+		"scope":                 "write_orders,read_customers",
+		"expires_in":            float64(86399),
+		"associated_user_scope": "write_orders",
+		"associated_user": map[string]interface{}{
+			"id":    float64(902541635),
+			"email": "john@example.com",
+		},
+	})
+	extra := ParseOauth2TokenExtra(token)
+	if toJSON(extra.Scopes()) != `["write_orders","read_customers"]` {
+		t.Error("scopes are not correct")
+	}
+	if extra.ExpiresIn != 86399 || extra.AssociatedUserScope != "write_orders" {
+		t.Error("extra is not correct")
+	}
+	if extra.AssociatedUser == nil || extra.AssociatedUser.Id != 902541635 ||
+		extra.AssociatedUser.Email != "john@example.com" {
+		t.Error("associated user is not correct")
+	}
+	if AccessModeOf(token) != OnlineAccess {
+		t.Error("token should be online")
+	}
+}
+
+func TestPickOauth2Token(t *testing.T) {
+	offline := &Oauth2Token{AccessToken: "offline"}
+	online := &Oauth2Token{AccessToken: "online", Expiry: time.Now().Add(time.Hour)}
+	expired := &Oauth2Token{AccessToken: "expired", Expiry: time.Now().Add(-time.Hour)}
+	if token, _ := PickOauth2Token(OnlineAccess, offline, expired, online); token != online {
+		t.Error("should pick online token")
+	}
+	if token, _ := PickOauth2Token(OfflineAccess, expired, online, offline); token != offline {
+		t.Error("should pick offline token")
+	}
+	if _, err := PickOauth2Token(OnlineAccess, offline, expired); err != ErrTokenExpired {
+		t.Error("should return ErrTokenExpired")
+	}
+	if _, err := PickOauth2Token(OnlineAccess, offline); err != ErrTokenNotFound {
+		t.Error("should return ErrTokenNotFound")
+	}
+	expiring := &Oauth2Token{AccessToken: "expiring", Expiry: time.Now().Add(5 * time.Second)}
+	if _, err := PickOauth2Token(OnlineAccess, expiring); err != ErrTokenExpired {
+		t.Error("token expiring within seconds should be expired")
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	requested := false
+	c := NewClientWithToken("demo", &Oauth2Token{AccessToken: "expired", Expiry: time.Now().Add(-time.Second)})
+	c.httpClient.Transport.(*transport).base.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requested = true
+		return nil, errors.New("should not be called")
+	})
+	err := c.New("{ shop { name } }").Do()
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("should return ErrTokenExpired instead of %v", err)
+	}
+	if requested {
+		t.Error("request should not be sent")
+	}
+}
+
+func signAppProxyQuery(query url.Values) url.Values {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var message string
+	for _, key := range keys {
+		message += key + "=" + strings.Join(query[key], ",")
+	}
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(message))
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return query
+}
+
+func TestAppProxyVerifier(t *testing.T) {
+	v := &AppProxyVerifier{ClientSecret: testSecret}
+	var shop, customerId, pathPrefix, rawQuery string
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shop = ShopFromContext(r.Context())
+		customerId = CustomerIdFromContext(r.Context())
+		pathPrefix = PathPrefixFromContext(r.Context())
+		rawQuery = r.URL.RawQuery
+	}))
+	request := func(query url.Values) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/proxy?"+query.Encode(), nil))
+		return w.Code
+	}
+	newQuery := func(timestamp time.Time) url.Values {
+		return url.Values{
+			"shop":                  {"demo.myshopify.com"},
+			"logged_in_customer_id": {"42"},
+			"path_prefix":           {"/apps/demo"},
+			"ids":                   {"1", "2"},
+			"timestamp":             {strconv.FormatInt(timestamp.Unix(), 10)},
+		}
+	}
+
+	if code := request(signAppProxyQuery(newQuery(time.Now()))); code != http.StatusOK {
+		t.Fatalf("request should be verified, got %d", code)
+	}
+	if shop != "demo" || customerId != "42" || pathPrefix != "/apps/demo" {
+		t.Error("context values are not correct")
+	}
+	if strings.Contains(rawQuery, "signature") {
+		t.Error("signature should be removed")
+	}
+
+	tampered := signAppProxyQuery(newQuery(time.Now()))
+	tampered.Set("logged_in_customer_id", "43")
+	if code := request(tampered); code != http.StatusUnauthorized {
+		t.Error("tampered request should be rejected")
+	}
+	if code := request(signAppProxyQuery(newQuery(time.Now().Add(-time.Hour)))); code != http.StatusUnauthorized {
+		t.Error("stale request should be rejected")
+	}
+	if err := v.Verify(newQuery(time.Now())); err != ErrInvalidSignature {
+		t.Error("request without signature should be rejected")
+	}
+
+	query := newQuery(time.Now())
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte("ids=1,2logged_in_customer_id=42path_prefix=/apps/demoshop=demo.myshopify.comtimestamp=" + query.Get("timestamp")))
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	v.ClientSecret = ""
+	if code := request(query); code != http.StatusInternalServerError {
+		t.Error("request should be rejected without client secret")
+	}
+	if err := v.Verify(query); err != ErrNoClientSecret {
+		t.Error("forged signature should not be verified without client secret")
+	}
+}
@@ -72,7 +72,10 @@ func (req *RestRequest) MustDo(dest ...interface{}) {
 // dest. Specify JSON path after each dest to efficiently get required info
 // from deep nested structs.
 func (req *RestRequest) Do(dest ...interface{}) error {
-	reqUrl := fmt.Sprintf("https://%s.myshopify.com/admin/api/2021-10/%s.json", req.client.Shop, req.route)
+	reqUrl, err := req.client.apiURL(req.route)
+	if err != nil {
+		return err
+	}
 	var values url.Values
 	switch query := req.query.(type) {
 	case map[string]string:
@@ -150,7 +153,7 @@ func (req *RestRequest) Do(dest ...interface{}) error {
 	if res.StatusCode == 401 {
 		return ErrUnauthorized
 	}
-	if res.StatusCode != 200 {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
 		return fmt.Errorf("response status is not ok: %d", res.StatusCode)
 	}
 	if len(dest) == 0 {
@@ -0,0 +1,31 @@
+package shopify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+// Introspect gets the Admin API schema of the API version of the client
+// using context.Background.
+func (client *Client) Introspect() (*graphql.Schema, error) {
+	return client.IntrospectWithContext(context.Background())
+}
+
+// IntrospectWithContext gets the Admin API schema of the API version of the
+// client. Save it with Schema.WriteFile and load it with
+// graphql.ReadSchemaFile to validate queries without network calls, see
+// Client.Schema.
+func (client *Client) IntrospectWithContext(ctx context.Context) (*graphql.Schema, error) {
+	var data struct {
+		Schema *graphql.Schema `json:"__schema"`
+	}
+	if err := client.New(graphql.IntrospectionQuery).WithContext(ctx).Do(&data); err != nil {
+		return nil, err
+	}
+	if data.Schema == nil {
+		return nil, errors.New("empty schema")
+	}
+	return data.Schema, nil
+}
@@ -0,0 +1,51 @@
+package shopify
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/shopify/graphql"
+)
+
+func TestIntrospect(t *testing.T) {
+	var paths []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "__schema") {
+			w.Write([]byte(`{"data":{"__schema":{"queryType":{"name":"QueryRoot"},"types":[` +
+				`{"kind":"OBJECT","name":"QueryRoot","fields":[{"name":"shop","args":[],"type":{"kind":"NON_NULL","ofType":{"kind":"OBJECT","name":"Shop"}}}]},` +
+				`{"kind":"OBJECT","name":"Shop","fields":[{"name":"name","args":[],"type":{"kind":"SCALAR","name":"String"}}]},` +
+				`{"kind":"SCALAR","name":"String"}]}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"shop":{"name":"Demo"}}}`))
+	}))
+	c.APIVersion = "2022-01"
+	schema, err := c.Introspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "2022-01.json")
+	if err := schema.WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if c.Schema, err = graphql.ReadSchemaFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.New("{ shop { title } }").Do()
+	if _, ok := err.(graphql.SchemaErrors); !ok || err.Error() != "graphql: anonymous query: shop: unknown field title on Shop" {
+		t.Error("unknown field should fail validation:", err)
+	}
+	var name string
+	if err := c.New("{ shop { name } }").Do(&name, "shop.name"); err != nil || name != "Demo" {
+		t.Error("result is not correct:", name, err)
+	}
+	if len(paths) != 2 || paths[0] != "/admin/api/2022-01/graphql.json" || paths[1] != paths[0] {
+		t.Error("requests are not correct:", paths)
+	}
+}
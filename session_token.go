@@ -0,0 +1,209 @@
+package shopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSessionToken = errors.New("invalid session token")
+)
+
+const defaultSessionTokenLeeway = 10 * time.Second
+
+type (
+	// Payload of an App Bridge session token.
+	SessionToken struct {
+		Iss  string `json:"iss"`
+		Dest string `json:"dest"`
+		Aud  string `json:"aud"`
+		Sub  string `json:"sub"`
+		Exp  int64  `json:"exp"`
+		Nbf  int64  `json:"nbf"`
+		Iat  int64  `json:"iat"`
+		Jti  string `json:"jti"`
+		Sid  string `json:"sid"`
+
+		Raw string `json:"-"` // the encoded token
+	}
+
+	// SessionTokenVerifier verifies App Bridge session tokens sent by
+	// embedded apps.
+	SessionTokenVerifier struct {
+		ClientID     string // API key of the app, expected in aud
+		ClientSecret string // API secret key of the app, used to sign tokens
+
+		// Allowed clock skew when checking exp and nbf, defaults to 10
+		// seconds.
+		Leeway time.Duration
+
+		// Called when verification fails in Middleware. If nil, 401
+		// Unauthorized is written.
+		OnError func(w http.ResponseWriter, r *http.Request, err error)
+	}
+
+	contextKey int
+
+	sessionTokenHeader struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}
+)
+
+const (
+	contextKeySessionToken contextKey = iota
+	contextKeyShop
+	contextKeyUserId
+	contextKeyCustomerId
+	contextKeyPathPrefix
+)
+
+// Verify checks the signature, issuer, destination, audience and validity
+// period of the encoded session token. ErrNoClientSecret is returned if
+// ClientSecret is empty.
+func (v *SessionTokenVerifier) Verify(token string) (*SessionToken, error) {
+	if v.ClientSecret == "" {
+		return nil, ErrNoClientSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidSessionToken("malformed token")
+	}
+	var header sessionTokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidSessionToken("malformed header")
+	}
+	if header.Alg != "HS256" {
+		return nil, invalidSessionToken("unexpected algorithm " + header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidSessionToken("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(v.ClientSecret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, invalidSessionToken("signature mismatch")
+	}
+	st := &SessionToken{Raw: token}
+	if err := decodeSegment(parts[1], st); err != nil {
+		return nil, invalidSessionToken("malformed payload")
+	}
+	if st.Aud != v.ClientID {
+		return nil, invalidSessionToken("audience mismatch")
+	}
+	dest, err := url.Parse(st.Dest)
+	if err != nil || dest.Scheme != "https" || dest.Path != "" {
+		return nil, invalidSessionToken("invalid destination")
+	}
+	if _, err := ShopFromDomain(dest.Host); err != nil {
+		return nil, invalidSessionToken("invalid destination")
+	}
+	if st.Iss != st.Dest+"/admin" {
+		return nil, invalidSessionToken("issuer mismatch")
+	}
+	leeway := v.Leeway
+	if leeway == 0 {
+		leeway = defaultSessionTokenLeeway
+	}
+	now := time.Now()
+	if now.After(time.Unix(st.Exp, 0).Add(leeway)) {
+		return nil, invalidSessionToken("token expired")
+	}
+	if now.Add(leeway).Before(time.Unix(st.Nbf, 0)) {
+		return nil, invalidSessionToken("token not valid yet")
+	}
+	return st, nil
+}
+
+// Middleware verifies the session token in the "Authorization: Bearer"
+// header and puts the token, shop and user id into the request context.
+func (v *SessionTokenVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			v.fail(w, r, invalidSessionToken("missing bearer token"))
+			return
+		}
+		st, err := v.Verify(strings.TrimSpace(auth[len("Bearer "):]))
+		if err != nil {
+			v.fail(w, r, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), contextKeySessionToken, st)
+		ctx = context.WithValue(ctx, contextKeyShop, st.Shop())
+		ctx = context.WithValue(ctx, contextKeyUserId, st.UserId())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (v *SessionTokenVerifier) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if v.OnError != nil {
+		v.OnError(w, r, err)
+		return
+	}
+	if err == ErrNoClientSecret {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// tells App Bridge to retry with a new session token
+	w.Header().Set("X-Shopify-Retry-Invalid-Session-Request", "1")
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// Shop returns the shop name of the destination.
+func (st *SessionToken) Shop() string {
+	dest, err := url.Parse(st.Dest)
+	if err != nil {
+		return ""
+	}
+	shop, _ := ShopFromDomain(dest.Host)
+	return shop
+}
+
+// UserId returns the id of the staff member, or 0 if sub is not a user id.
+func (st *SessionToken) UserId() int64 {
+	id, _ := strconv.ParseInt(st.Sub, 10, 64)
+	return id
+}
+
+// SessionTokenFromContext returns the session token verified by
+// SessionTokenVerifier.Middleware.
+func SessionTokenFromContext(ctx context.Context) *SessionToken {
+	st, _ := ctx.Value(contextKeySessionToken).(*SessionToken)
+	return st
+}
+
+// ShopFromContext returns the shop name of a verified request.
+func ShopFromContext(ctx context.Context) string {
+	shop, _ := ctx.Value(contextKeyShop).(string)
+	return shop
+}
+
+// UserIdFromContext returns the staff member id of a verified session token.
+func UserIdFromContext(ctx context.Context) int64 {
+	id, _ := ctx.Value(contextKeyUserId).(int64)
+	return id
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func invalidSessionToken(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSessionToken, reason)
+}
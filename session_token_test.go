@@ -0,0 +1,104 @@
+package shopify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signSessionToken(payload map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(toJSON(payload)))
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(header + "." + body))
+	return header + "." + body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newSessionTokenPayload() map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":  "https://demo.myshopify.com/admin",
+		"dest": "https://demo.myshopify.com",
+		"aud":  "clientid",
+		"sub":  "42",
+		"exp":  now + 60,
+		"nbf":  now,
+		"iat":  now,
+		"jti":  "00000000-0000-0000-0000-000000000000",
+		"sid":  "session",
+	}
+}
+
+func TestSessionTokenVerifier(t *testing.T) {
+	v := &SessionTokenVerifier{ClientID: "clientid", ClientSecret: testSecret}
+
+	st, err := v.Verify(signSessionToken(newSessionTokenPayload()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Shop() != "demo" || st.UserId() != 42 {
+		t.Error("shop or user id is not correct")
+	}
+
+	for key, value := range map[string]interface{}{
+		"aud":  "other",
+		"iss":  "https://other.myshopify.com/admin",
+		"dest": "https://evil.com",
+		"exp":  time.Now().Add(-time.Minute).Unix(),
+		"nbf":  time.Now().Add(time.Minute).Unix(),
+	} {
+		payload := newSessionTokenPayload()
+		payload[key] = value
+		if _, err := v.Verify(signSessionToken(payload)); !errors.Is(err, ErrInvalidSessionToken) {
+			t.Errorf("token with wrong %s should be invalid", key)
+		}
+	}
+
+	payload := newSessionTokenPayload()
+	payload["exp"] = time.Now().Add(-5 * time.Second).Unix()
+	if _, err := v.Verify(signSessionToken(payload)); err != nil {
+		t.Error("token within leeway should be valid")
+	}
+
+	token := signSessionToken(newSessionTokenPayload())
+	if _, err := v.Verify(token[:len(token)-2]); !errors.Is(err, ErrInvalidSessionToken) {
+		t.Error("token with wrong signature should be invalid")
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(toJSON(newSessionTokenPayload())))
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte(header + "." + body))
+	forged := header + "." + body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if _, err := (&SessionTokenVerifier{ClientID: "clientid"}).Verify(forged); err != ErrNoClientSecret {
+		t.Error("token should not be verified without client secret:", err)
+	}
+}
+
+func TestSessionTokenMiddleware(t *testing.T) {
+	v := &SessionTokenVerifier{ClientID: "clientid", ClientSecret: testSecret}
+	var shop string
+	var userId int64
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shop, userId = ShopFromContext(r.Context()), UserIdFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("X-Shopify-Retry-Invalid-Session-Request") != "1" {
+		t.Error("request without token should be unauthorized")
+	}
+
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("Authorization", "Bearer "+signSessionToken(newSessionTokenPayload()))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || shop != "demo" || userId != 42 {
+		t.Error("shop and user id should be in context")
+	}
+}
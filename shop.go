@@ -0,0 +1,62 @@
+package shopify
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidShop = errors.New("invalid shop domain")
+
+	reShopName      = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*$`)
+	reShopDomain    = regexp.MustCompile(`^([a-z0-9][a-z0-9\-]*)\.myshopify\.com$`)
+	reShopAdminPath = regexp.MustCompile(`^/store/([a-z0-9][a-z0-9\-]*)(/.*)?$`)
+)
+
+// NormalizeShop returns the shop name of a user supplied shop, which can be
+// a shop name ("foo"), a domain ("foo.myshopify.com", with or without https
+// scheme) or an admin url ("https://admin.shopify.com/store/foo"). Anything
+// else returns ErrInvalidShop.
+func NormalizeShop(shop string) (string, error) {
+	shop = strings.ToLower(strings.TrimSpace(shop))
+	if reShopName.MatchString(shop) {
+		return shop, nil
+	}
+	if m := reShopDomain.FindStringSubmatch(shop); m != nil {
+		return m[1], nil
+	}
+	if !strings.Contains(shop, "://") {
+		if !strings.HasPrefix(shop, "admin.shopify.com/") {
+			return "", ErrInvalidShop
+		}
+		shop = "https://" + shop
+	}
+	u, err := url.Parse(shop)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") ||
+		u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", ErrInvalidShop
+	}
+	if u.Host == "admin.shopify.com" {
+		if m := reShopAdminPath.FindStringSubmatch(u.Path); m != nil {
+			return m[1], nil
+		}
+		return "", ErrInvalidShop
+	}
+	if m := reShopDomain.FindStringSubmatch(u.Host); m != nil && (u.Path == "" || u.Path == "/") {
+		return m[1], nil
+	}
+	return "", ErrInvalidShop
+}
+
+// ShopFromDomain returns the shop name of a shop domain sent by Shopify,
+// which must be exactly like "foo.myshopify.com". Unlike NormalizeShop,
+// schemes, urls, shop names and uppercase letters are not accepted. Use it
+// for shops in signed requests, and NormalizeShop for user input.
+func ShopFromDomain(domain string) (string, error) {
+	if m := reShopDomain.FindStringSubmatch(domain); m != nil {
+		return m[1], nil
+	}
+	return "", ErrInvalidShop
+}
@@ -0,0 +1,75 @@
+package shopify
+
+import (
+	"testing"
+)
+
+func TestNormalizeShop(t *testing.T) {
+	for input, expected := range map[string]string{
+		"foo":                                  "foo",
+		" Foo-Bar ":                            "foo-bar",
+		"foo.myshopify.com":                    "foo",
+		"https://foo.myshopify.com":            "foo",
+		"https://foo.myshopify.com/":           "foo",
+		"https://admin.shopify.com/store/foo":  "foo",
+		"admin.shopify.com/store/foo/products": "foo",
+		"https://admin.shopify.com/store/foo/": "foo",
+		"evil.com/x?":                          "",
+		"evil.com":                             "",
+		"foo.myshopify.com.evil.com":           "",
+		"foo.myshopify.com/../../evil":         "",
+		"https://foo.myshopify.com/admin":      "",
+		"https://foo.myshopify.com:8080":       "",
+		"https://user@foo.myshopify.com":       "",
+		"https://evil.com/store/foo":           "",
+		"https://admin.shopify.com/store/../x": "",
+		"ftp://foo.myshopify.com":              "",
+		"-foo":                                 "",
+		"":                                     "",
+	} {
+		shop, err := NormalizeShop(input)
+		if expected == "" {
+			if err != ErrInvalidShop {
+				t.Errorf("%q should be invalid, got %q", input, shop)
+			}
+			continue
+		}
+		if err != nil || shop != expected {
+			t.Errorf("%q should be %q, got %q, %v", input, expected, shop, err)
+		}
+	}
+}
+
+func TestShopFromDomain(t *testing.T) {
+	if shop, err := ShopFromDomain("foo-bar.myshopify.com"); err != nil || shop != "foo-bar" {
+		t.Error("shop domain should be valid:", shop, err)
+	}
+	for _, domain := range []string{
+		"foo",
+		"Foo.myshopify.com",
+		" foo.myshopify.com",
+		"https://foo.myshopify.com",
+		"foo.myshopify.com/",
+		"https://admin.shopify.com/store/foo",
+		"foo.myshopify.com.evil.com",
+		"",
+	} {
+		if _, err := ShopFromDomain(domain); err != ErrInvalidShop {
+			t.Errorf("%q should be invalid", domain)
+		}
+	}
+}
+
+func TestInvalidShop(t *testing.T) {
+	c := NewClientWithToken("https://admin.shopify.com/store/demo", &Oauth2Token{AccessToken: "shpat_test"})
+	if c.Shop != "demo" {
+		t.Error("shop should be normalized")
+	}
+	c = NewClientWithToken("evil.com/x?", &Oauth2Token{AccessToken: "shpat_test"})
+	if err := c.New("{ shop { name } }").Do(); err != ErrInvalidShop {
+		t.Errorf("should return ErrInvalidShop instead of %v", err)
+	}
+	if err := c.NewRest("GET", "shop").Do(); err != ErrInvalidShop {
+		t.Errorf("should return ErrInvalidShop instead of %v", err)
+	}
+}
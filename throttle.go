@@ -0,0 +1,86 @@
+package shopify
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type (
+	// Cost of a GraphQL query in the extensions of the response.
+	QueryCost struct {
+		RequestedQueryCost float64        `json:"requestedQueryCost"`
+		ActualQueryCost    float64        `json:"actualQueryCost"`
+		ThrottleStatus     ThrottleStatus `json:"throttleStatus"`
+	}
+
+	// Status of the leaky bucket of GraphQL query cost of a shop.
+	ThrottleStatus struct {
+		MaximumAvailable   float64 `json:"maximumAvailable"`
+		CurrentlyAvailable float64 `json:"currentlyAvailable"`
+		RestoreRate        float64 `json:"restoreRate"` // per second
+	}
+)
+
+// ThrottleStatus returns the estimated throttle status of the shop based on
+// the last GraphQL response, or nil if it is unknown.
+func (client *Client) ThrottleStatus() *ThrottleStatus {
+	client.throttleMu.Lock()
+	defer client.throttleMu.Unlock()
+	if client.throttle.RestoreRate == 0 {
+		return nil
+	}
+	status := client.throttle
+	status.CurrentlyAvailable = client.availableCost()
+	return &status
+}
+
+// updateThrottle releases the cost reserved by a finished request, and
+// applies the throttle status in its response, minus the cost reserved by
+// other requests not finished, as the status does not include them yet.
+func (client *Client) updateThrottle(cost *QueryCost, reserved float64) {
+	client.throttleMu.Lock()
+	defer client.throttleMu.Unlock()
+	client.throttleReserved -= reserved
+	if cost == nil {
+		return
+	}
+	client.throttle = cost.ThrottleStatus
+	client.throttle.CurrentlyAvailable -= client.throttleReserved
+	client.throttleAt = time.Now()
+}
+
+// waitThrottle blocks until the estimated available query cost is enough for
+// cost and reserves it. It returns the reserved cost, which must be set to
+// the request to be released, or 0 if the throttle status is unknown.
+func (client *Client) waitThrottle(ctx context.Context, cost float64) (float64, error) {
+	for {
+		client.throttleMu.Lock()
+		if client.throttle.RestoreRate == 0 {
+			client.throttleMu.Unlock()
+			return 0, nil
+		}
+		cost = math.Min(cost, client.throttle.MaximumAvailable)
+		available := client.availableCost()
+		if available >= cost {
+			client.throttle.CurrentlyAvailable = available - cost
+			client.throttleAt = time.Now()
+			client.throttleReserved += cost
+			client.throttleMu.Unlock()
+			return cost, nil
+		}
+		wait := time.Duration((cost - available) / client.throttle.RestoreRate * float64(time.Second))
+		client.throttleMu.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// availableCost must be called with throttleMu held.
+func (client *Client) availableCost() float64 {
+	restored := client.throttle.RestoreRate * time.Since(client.throttleAt).Seconds()
+	return math.Min(client.throttle.MaximumAvailable, client.throttle.CurrentlyAvailable+restored)
+}
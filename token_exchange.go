@@ -0,0 +1,151 @@
+package shopify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	idTokenType            = "urn:ietf:params:oauth:token-type:id_token"
+	offlineAccessTokenType = "urn:shopify:params:oauth:token-type:offline-access-token"
+	onlineAccessTokenType  = "urn:shopify:params:oauth:token-type:online-access-token"
+)
+
+type (
+	tokenExchangeRequest struct {
+		ClientID           string `json:"client_id"`
+		ClientSecret       string `json:"client_secret"`
+		GrantType          string `json:"grant_type"`
+		SubjectToken       string `json:"subject_token"`
+		SubjectTokenType   string `json:"subject_token_type"`
+		RequestedTokenType string `json:"requested_token_type"`
+		Expiring           string `json:"expiring,omitempty"`
+	}
+
+	tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	tokenExchangeSource struct {
+		ctx  context.Context
+		conf *Oauth2Config
+		st   *SessionToken
+		mode AccessMode
+
+		mu    sync.Mutex
+		token *Oauth2Token
+	}
+)
+
+// ExchangeSessionToken exchanges a verified session token for an access token
+// of the access mode for the shop of the session token. Only the client id
+// and client secret of the config are used. Like Oauth2Config.Exchange, the
+// HTTP client can be set with the Oauth2HTTPClient context key.
+func ExchangeSessionToken(ctx context.Context, conf *Oauth2Config, st *SessionToken, mode AccessMode) (*Oauth2Token, error) {
+	endpoint, err := Oauth2ShopEndpoint(st.Shop())
+	if err != nil {
+		return nil, err
+	}
+	req := tokenExchangeRequest{
+		ClientID:           conf.ClientID,
+		ClientSecret:       conf.ClientSecret,
+		GrantType:          tokenExchangeGrantType,
+		SubjectToken:       st.Raw,
+		SubjectTokenType:   idTokenType,
+		RequestedTokenType: offlineAccessTokenType,
+	}
+	switch mode {
+	case OnlineAccess:
+		req.RequestedTokenType = onlineAccessTokenType
+	case ExpiringOfflineAccess:
+		req.Expiring = "1"
+	}
+	return requestToken(ctx, endpoint.TokenURL, req)
+}
+
+// SessionTokenSource returns a token source that exchanges the session token
+// for an access token with ctx when it is first needed, and reuses it for
+// the rest of the request. Use it with NewClientWithTokenSource for a single
+// request only: session tokens expire in a minute, so the access token is
+// never exchanged again and ErrTokenExpired is returned once it expires.
+// To use the access token after the request, save the token returned by
+// ExchangeSessionToken instead.
+func SessionTokenSource(ctx context.Context, conf *Oauth2Config, st *SessionToken, mode AccessMode) Oauth2TokenSource {
+	return &tokenExchangeSource{ctx: ctx, conf: conf, st: st, mode: mode}
+}
+
+func (s *tokenExchangeSource) Token() (*Oauth2Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		token, err := ExchangeSessionToken(s.ctx, s.conf, s.st, s.mode)
+		if err != nil {
+			return nil, err
+		}
+		s.token = token
+	}
+	if tokenExpired(s.token) {
+		return nil, ErrTokenExpired
+	}
+	return s.token, nil
+}
+
+// requestToken posts the JSON body to the token url and returns the token
+// with all fields of the response as extra.
+func requestToken(ctx context.Context, tokenURL string, body interface{}) (*Oauth2Token, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	res, err := contextHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, &Oauth2RetrieveError{Response: res, Body: b}
+	}
+	var resp tokenResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, &Oauth2RetrieveError{Response: res, Body: b}
+	}
+	var raw map[string]interface{}
+	json.Unmarshal(b, &raw)
+	token := (&Oauth2Token{
+		AccessToken:  resp.AccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: resp.RefreshToken,
+	}).WithExtra(raw)
+	if resp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+func contextHTTPClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(Oauth2HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,76 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExchangeSessionToken(t *testing.T) {
+	sessionToken := signSessionToken(newSessionTokenPayload())
+	exchanges := 0
+	server := newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin/oauth/access_token":
+			var req tokenExchangeRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.GrantType != tokenExchangeGrantType || req.SubjectToken != sessionToken ||
+				req.RequestedTokenType != onlineAccessTokenType || req.ClientSecret != testSecret {
+				w.WriteHeader(400)
+				w.Write([]byte(`{"error":"invalid_request"}`))
+				return
+			}
+			exchanges++
+			w.Write([]byte(`{"access_token":"shpua_test","scope":"read_products","expires_in":86399,
+"associated_user_scope":"read_products","associated_user":{"id":42,"email":"john@example.com"}}`))
+		case "/admin/api/2021-10/graphql.json":
+			w.Write([]byte(`{"data":{"shop":{"name":"` + r.Header.Get("X-Shopify-Access-Token") + `"}}}`))
+		}
+	}))
+
+	v := &SessionTokenVerifier{ClientID: "clientid", ClientSecret: testSecret}
+	st, err := v.Verify(sessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Oauth2Config{ClientID: "clientid", ClientSecret: testSecret}
+	ctx := context.WithValue(context.Background(), Oauth2HTTPClient, server)
+
+	token, err := ExchangeSessionToken(ctx, conf, st, OnlineAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "shpua_test" || token.Expiry.IsZero() || AccessModeOf(token) != OnlineAccess {
+		t.Error("token is not correct")
+	}
+	if user := ParseOauth2TokenExtra(token).AssociatedUser; user == nil || user.Id != 42 {
+		t.Error("associated user is not correct")
+	}
+
+	if _, err := ExchangeSessionToken(ctx, conf, st, OfflineAccess); err == nil {
+		t.Error("failed exchange should return error")
+	} else if _, ok := err.(*Oauth2RetrieveError); !ok {
+		t.Errorf("error should be Oauth2RetrieveError instead of %T", err)
+	}
+
+	c := NewClientWithTokenSource(st.Shop(), SessionTokenSource(ctx, conf, st, OnlineAccess))
+	c.httpClient.Transport.(*transport).base.Base = server.Transport
+	for i := 0; i < 2; i++ {
+		var name string
+		c.New("{ shop { name } }").MustDo(&name, "shop.name")
+		if name != "shpua_test" {
+			t.Error("access token should be sent")
+		}
+	}
+	if exchanges != 2 {
+		t.Errorf("token should be reused, exchanged %d times", exchanges)
+	}
+
+	src := c.httpClient.Transport.(*transport).base.Source.(*tokenExchangeSource)
+	src.token.Expiry = time.Now().Add(-time.Second)
+	if _, err := src.Token(); err != ErrTokenExpired || exchanges != 2 {
+		t.Error("expired token should not be exchanged again")
+	}
+}
@@ -0,0 +1,95 @@
+package shopify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultRefreshLeeway = time.Minute
+
+type (
+	// RefreshingTokenSource is a token source of expiring offline access
+	// tokens. It refreshes the token before it expires and is safe for
+	// concurrent use. Refresh tokens are rotated by Shopify on each
+	// refresh, so the new token must be saved in OnRefresh.
+	RefreshingTokenSource struct {
+		// Refresh the token this long before it expires, defaults to 1
+		// minute.
+		Leeway time.Duration
+
+		// Called with the new token after each refresh. If it returns an
+		// error, Token returns the error but the new token is still used.
+		OnRefresh func(token *Oauth2Token) error
+
+		ctx          context.Context
+		clientID     string
+		clientSecret string
+		tokenURL     string
+
+		mu    sync.Mutex
+		token *Oauth2Token
+	}
+
+	refreshTokenRequest struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		GrantType    string `json:"grant_type"`
+		RefreshToken string `json:"refresh_token"`
+	}
+)
+
+// NewRefreshingTokenSource creates a token source of the shop from the client
+// id and client secret of the config and an expiring offline token. Like
+// Oauth2Config.Exchange, the HTTP client can be set with the Oauth2HTTPClient
+// context key.
+func NewRefreshingTokenSource(ctx context.Context, conf *Oauth2Config, shop string, token *Oauth2Token, onRefresh func(*Oauth2Token) error) (*RefreshingTokenSource, error) {
+	endpoint, err := Oauth2ShopEndpoint(shop)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshingTokenSource{
+		OnRefresh:    onRefresh,
+		ctx:          ctx,
+		clientID:     conf.ClientID,
+		clientSecret: conf.ClientSecret,
+		tokenURL:     endpoint.TokenURL,
+		token:        token,
+	}, nil
+}
+
+// Token returns the current token, or refreshes it if it expires within the
+// leeway. Concurrent calls wait for the same refresh.
+func (s *RefreshingTokenSource) Token() (*Oauth2Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leeway := s.Leeway
+	if leeway == 0 {
+		leeway = defaultRefreshLeeway
+	}
+	if s.token.Expiry.IsZero() || time.Now().Add(leeway).Before(s.token.Expiry) {
+		return s.token, nil
+	}
+	if s.token.RefreshToken == "" {
+		return nil, ErrTokenExpired
+	}
+	token, err := requestToken(s.ctx, s.tokenURL, refreshTokenRequest{
+		ClientID:     s.clientID,
+		ClientSecret: s.clientSecret,
+		GrantType:    "refresh_token",
+		RefreshToken: s.token.RefreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+	s.token = token
+	if s.OnRefresh != nil {
+		if err := s.OnRefresh(token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,73 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshingTokenSource(t *testing.T) {
+	var mu sync.Mutex
+	refreshes := 0
+	server := newTestHTTPClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req refreshTokenRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		if req.GrantType != "refresh_token" || req.RefreshToken != "shprt_"+strconv.Itoa(refreshes) {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		refreshes++
+		n := strconv.Itoa(refreshes)
+		w.Write([]byte(`{"access_token":"shpat_` + n + `","expires_in":3600,"refresh_token":"shprt_` + n + `",
+"refresh_token_expires_in":7776000,"scope":"read_products"}`))
+	}))
+	ctx := context.WithValue(context.Background(), Oauth2HTTPClient, server)
+	conf := &Oauth2Config{ClientID: "clientid", ClientSecret: testSecret}
+
+	var saved []*Oauth2Token
+	src, err := NewRefreshingTokenSource(ctx, conf, "demo", &Oauth2Token{
+		AccessToken:  "shpat_0",
+		RefreshToken: "shprt_0",
+		Expiry:       time.Now().Add(30 * time.Second),
+	}, func(token *Oauth2Token) error {
+		saved = append(saved, token)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := src.Token()
+			if err != nil || token.AccessToken != "shpat_1" {
+				t.Errorf("token should be refreshed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 || len(saved) != 1 || saved[0].RefreshToken != "shprt_1" {
+		t.Fatal("token should be refreshed once and saved")
+	}
+	if AccessModeOf(saved[0]) != ExpiringOfflineAccess {
+		t.Error("token should be expiring offline")
+	}
+	if ParseOauth2TokenExtra(saved[0]).RefreshTokenExpiresIn != 7776000 {
+		t.Error("refresh token expiry is not correct")
+	}
+
+	src.Leeway = 2 * time.Hour
+	if token, _ := src.Token(); token == nil || token.AccessToken != "shpat_2" {
+		t.Error("token should be refreshed with rotated refresh token")
+	}
+}
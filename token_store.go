@@ -0,0 +1,316 @@
+package shopify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+type (
+	// TokenStore saves access tokens by shop name. Offline tokens are saved
+	// with user id 0 and online tokens with the id of the associated user.
+	TokenStore interface {
+		// LoadToken returns ErrTokenNotFound if there is no token.
+		LoadToken(ctx context.Context, shop string, userId int64) (*Oauth2Token, error)
+		SaveToken(ctx context.Context, shop string, userId int64, token *Oauth2Token) error
+		// DeleteTokens deletes offline and online tokens of a shop.
+		DeleteTokens(ctx context.Context, shop string) error
+	}
+
+	// MemoryTokenStore keeps tokens in memory.
+	MemoryTokenStore struct {
+		mu     sync.RWMutex
+		tokens map[string]map[int64]*Oauth2Token
+	}
+
+	// FileTokenStore saves tokens as JSON files in a directory, one
+	// sub-directory for each shop. Files are encrypted with AES-GCM if it
+	// is created by NewEncryptedFileTokenStore.
+	FileTokenStore struct {
+		Dir string
+
+		aead cipher.AEAD
+	}
+
+	// token with extra fields of the token response
+	storedToken struct {
+		Oauth2Token
+		Extra *Oauth2TokenExtra `json:"extra,omitempty"`
+	}
+)
+
+// NewMemoryTokenStore creates an empty in-memory token store.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: map[string]map[int64]*Oauth2Token{},
+	}
+}
+
+func (s *MemoryTokenStore) LoadToken(ctx context.Context, shop string, userId int64) (*Oauth2Token, error) {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token := s.tokens[shop][userId]
+	if token == nil {
+		return nil, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+func (s *MemoryTokenStore) SaveToken(ctx context.Context, shop string, userId int64, token *Oauth2Token) error {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[shop] == nil {
+		s.tokens[shop] = map[int64]*Oauth2Token{}
+	}
+	s.tokens[shop][userId] = token
+	return nil
+}
+
+// Shops returns names of shops with an offline token.
+func (s *MemoryTokenStore) Shops(ctx context.Context) (shops []string, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for shop := range s.tokens {
+		if s.tokens[shop][0] != nil {
+			shops = append(shops, shop)
+		}
+	}
+	sort.Strings(shops)
+	return
+}
+
+func (s *MemoryTokenStore) DeleteTokens(ctx context.Context, shop string) error {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, shop)
+	return nil
+}
+
+// NewFileTokenStore creates a token store of plain JSON files in dir.
+func NewFileTokenStore(dir string) *FileTokenStore {
+	return &FileTokenStore{Dir: dir}
+}
+
+// NewEncryptedFileTokenStore creates a token store of files in dir encrypted
+// with AES-GCM. The key must be 16, 24 or 32 bytes long.
+func NewEncryptedFileTokenStore(dir string, key []byte) (*FileTokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTokenStore{Dir: dir, aead: aead}, nil
+}
+
+func (s *FileTokenStore) LoadToken(ctx context.Context, shop string, userId int64) (*Oauth2Token, error) {
+	path, key, err := s.path(shop, userId)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.aead != nil {
+		size := s.aead.NonceSize()
+		if len(b) < size {
+			return nil, ErrInvalidCiphertext
+		}
+		b, err = s.aead.Open(nil, b[:size], b[size:], []byte(key))
+		if err != nil {
+			return nil, ErrInvalidCiphertext
+		}
+	}
+	var stored storedToken
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	token := &stored.Oauth2Token
+	if stored.Extra != nil {
+		var extra map[string]interface{}
+		b, _ := json.Marshal(stored.Extra)
+		json.Unmarshal(b, &extra)
+		token = token.WithExtra(extra)
+	}
+	return token, nil
+}
+
+func (s *FileTokenStore) SaveToken(ctx context.Context, shop string, userId int64, token *Oauth2Token) error {
+	path, key, err := s.path(shop, userId)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(storedToken{*token, ParseOauth2TokenExtra(token)})
+	if err != nil {
+		return err
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		b = s.aead.Seal(nonce, nonce, b, []byte(key))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// write to a temporary file first so that readers never see a
+	// partially written token
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".token")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileTokenStore) DeleteTokens(ctx context.Context, shop string) error {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.Dir, shop))
+}
+
+// Shops returns names of shops with an offline token.
+func (s *FileTokenStore) Shops(ctx context.Context) (shops []string, err error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.Dir, info.Name(), "offline.json")); err == nil {
+			shops = append(shops, info.Name())
+		}
+	}
+	return
+}
+
+// path returns the file path of the token, and its key like "demo/offline"
+// or "demo/user_42", which is the additional data of the encryption so that
+// tokens can still be read if Dir is moved or spelled differently.
+func (s *FileTokenStore) path(shop string, userId int64) (path, key string, err error) {
+	shop, err = NormalizeShop(shop)
+	if err != nil {
+		return
+	}
+	name := "offline"
+	if userId != 0 {
+		name = "user_" + strconv.FormatInt(userId, 10)
+	}
+	return filepath.Join(s.Dir, shop, name+".json"), shop + "/" + name, nil
+}
+
+// LoadClient returns a client of a shop with its offline token in the store.
+// If the token is an expiring offline token and conf is not nil, it is
+// refreshed with conf and the new token is saved to the store.
+func LoadClient(ctx context.Context, store TokenStore, shop string, conf *Oauth2Config) (*Client, error) {
+	shop, err := NormalizeShop(shop)
+	if err != nil {
+		return nil, err
+	}
+	src, err := loadTokenSource(ctx, ctx, store, shop, conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithTokenSource(shop, src), nil
+}
+
+// SaveToken saves a token obtained from the token endpoint to the store, as
+// an online token if it has an associated user. It can be used in
+// InstallHandler.OnInstall.
+func SaveToken(ctx context.Context, store TokenStore, shop string, token *Oauth2Token) error {
+	var userId int64
+	if user := ParseOauth2TokenExtra(token).AssociatedUser; user != nil {
+		userId = user.Id
+	}
+	return store.SaveToken(ctx, shop, userId, token)
+}
+
+// loadTokenSource loads the offline token of the shop with ctx. The token
+// source refreshes the token and saves it with refreshCtx.
+func loadTokenSource(ctx, refreshCtx context.Context, store TokenStore, shop string, conf *Oauth2Config) (Oauth2TokenSource, error) {
+	token, err := store.LoadToken(ctx, shop, 0)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" || conf == nil {
+		return Oauth2StaticTokenSource(token), nil
+	}
+	return NewRefreshingTokenSource(refreshCtx, conf, shop, token, func(token *Oauth2Token) error {
+		return store.SaveToken(refreshCtx, shop, 0, token)
+	})
+}
+
+// UninstallHandler returns a handler of the app/uninstalled webhook. It
+// verifies the webhook with the app's client secret, deletes all tokens of
+// the shop, then calls onUninstall if it is not nil.
+func UninstallHandler(secret string, store TokenStore, onUninstall func(ctx context.Context, shop string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := VerifyWebhook(r, secret); err != nil {
+			writeVerifyError(w, err)
+			return
+		}
+		if topic := r.Header.Get("X-Shopify-Topic"); topic != "app/uninstalled" {
+			http.Error(w, "unexpected topic "+topic, http.StatusBadRequest)
+			return
+		}
+		shop, err := ShopFromDomain(r.Header.Get("X-Shopify-Shop-Domain"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := store.DeleteTokens(r.Context(), shop); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if onUninstall != nil {
+			onUninstall(r.Context(), shop)
+		}
+	})
+}
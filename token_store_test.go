@@ -0,0 +1,148 @@
+package shopify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStores(t *testing.T) {
+	dir := t.TempDir()
+	encrypted, err := NewEncryptedFileTokenStore(filepath.Join(dir, "encrypted"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]TokenStore{
+		"memory":    NewMemoryTokenStore(),
+		"file":      NewFileTokenStore(filepath.Join(dir, "file")),
+		"encrypted": encrypted,
+	}
+	ctx := context.Background()
+	offline := &Oauth2Token{AccessToken: "shpat_test"}
+	online := (&Oauth2Token{AccessToken: "shpua_test", Expiry: time.Now().Add(time.Hour)}).
+		WithExtra(map[string]interface{}{
+			"scope":           "read_products",
+			"associated_user": map[string]interface{}{"id": float64(42)},
+		})
+	for name, store := range stores {
+		if _, err := store.LoadToken(ctx, "demo", 0); err != ErrTokenNotFound {
+			t.Errorf("%s: should return ErrTokenNotFound", name)
+		}
+		if err := store.SaveToken(ctx, "../evil", 0, offline); err != ErrInvalidShop {
+			t.Errorf("%s: invalid shop should be rejected", name)
+		}
+		if err := SaveToken(ctx, store, "demo", offline); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveToken(ctx, store, "demo.myshopify.com", online); err != nil {
+			t.Fatal(err)
+		}
+		token, err := store.LoadToken(ctx, "demo", 0)
+		if err != nil || token.AccessToken != "shpat_test" {
+			t.Errorf("%s: offline token is not correct", name)
+		}
+		token, err = store.LoadToken(ctx, "demo", 42)
+		if err != nil || token.AccessToken != "shpua_test" || AccessModeOf(token) != OnlineAccess ||
+			ParseOauth2TokenExtra(token).Scope != "read_products" {
+			t.Errorf("%s: online token is not correct", name)
+		}
+		if err := store.DeleteTokens(ctx, "demo"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.LoadToken(ctx, "demo", 42); err != ErrTokenNotFound {
+			t.Errorf("%s: tokens should be deleted", name)
+		}
+	}
+
+	encrypted.SaveToken(ctx, "demo", 0, offline)
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "encrypted", "demo", "offline.json"))
+	if bytes.Contains(b, []byte("shpat_test")) {
+		t.Error("token should be encrypted")
+	}
+	os.MkdirAll(filepath.Join(dir, "encrypted", "other"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "encrypted", "other", "offline.json"), b, 0600)
+	if _, err := encrypted.LoadToken(ctx, "other", 0); err != ErrInvalidCiphertext {
+		t.Error("token of another shop should not be decrypted")
+	}
+	os.Rename(filepath.Join(dir, "encrypted", "demo", "offline.json"), filepath.Join(dir, "encrypted", "demo", "user_1.json"))
+	if _, err := encrypted.LoadToken(ctx, "demo", 1); err != ErrInvalidCiphertext {
+		t.Error("offline token should not be decrypted as a user token")
+	}
+
+	wd, _ := os.Getwd()
+	rel, err := filepath.Rel(wd, filepath.Join(dir, "encrypted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, _ := NewEncryptedFileTokenStore(rel, bytes.Repeat([]byte{1}, 32))
+	if err := relative.SaveToken(ctx, "demo", 0, offline); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(dir, "moved")
+	os.Rename(filepath.Join(dir, "encrypted"), moved)
+	encrypted.Dir = moved + string(filepath.Separator)
+	if token, err := encrypted.LoadToken(ctx, "demo", 0); err != nil || token.AccessToken != "shpat_test" {
+		t.Error("token should be decrypted from another spelling of the directory:", err)
+	}
+}
+
+func TestLoadClient(t *testing.T) {
+	store := NewMemoryTokenStore()
+	ctx := context.Background()
+	if _, err := LoadClient(ctx, store, "demo", nil); err != ErrTokenNotFound {
+		t.Error("should return ErrTokenNotFound")
+	}
+	store.SaveToken(ctx, "demo", 0, &Oauth2Token{AccessToken: "shpat_test"})
+	c, err := LoadClient(ctx, store, "demo", nil)
+	if err != nil || c.Shop != "demo" {
+		t.Error("client is not correct")
+	}
+}
+
+func TestUninstallHandler(t *testing.T) {
+	store := NewMemoryTokenStore()
+	ctx := context.Background()
+	store.SaveToken(ctx, "demo", 0, &Oauth2Token{AccessToken: "shpat_test"})
+	var uninstalled string
+	h := UninstallHandler(testSecret, store, func(ctx context.Context, shop string) {
+		uninstalled = shop
+	})
+
+	request := func(body, hmacBody string) *httptest.ResponseRecorder {
+		mac := hmac.New(sha256.New, []byte(testSecret))
+		mac.Write([]byte(hmacBody))
+		r := httptest.NewRequest("POST", "/webhooks/app/uninstalled", strings.NewReader(body))
+		r.Header.Set("X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		r.Header.Set("X-Shopify-Topic", "app/uninstalled")
+		r.Header.Set("X-Shopify-Shop-Domain", "demo.myshopify.com")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request(`{"id":1}`, `{"id":2}`); w.Code != http.StatusUnauthorized {
+		t.Error("webhook with wrong hmac should be rejected")
+	}
+	if _, err := store.LoadToken(ctx, "demo", 0); err != nil {
+		t.Error("token should not be deleted")
+	}
+	if w := request(`{"id":1}`, `{"id":1}`); w.Code != http.StatusOK {
+		t.Errorf("webhook failed: %d", w.Code)
+	}
+	if _, err := store.LoadToken(ctx, "demo", 0); err != ErrTokenNotFound {
+		t.Error("token should be deleted")
+	}
+	if uninstalled != "demo" {
+		t.Error("onUninstall should be called")
+	}
+}
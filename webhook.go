@@ -0,0 +1,62 @@
+package shopify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	ErrNoClientSecret = errors.New("client secret is required to verify requests from Shopify")
+	ErrBodyTooLarge   = errors.New("request body is too large")
+)
+
+// Maximum size of bodies read by VerifyWebhook.
+const maxWebhookBodySize = 10 << 20
+
+// VerifyWebhook reads the body of a request signed by Shopify in the
+// X-Shopify-Hmac-Sha256 header, like webhooks, and returns the body if it is
+// signed with the app's client secret. The body of the request can be read
+// again after verification. ErrNoClientSecret is returned if secret is
+// empty, and ErrBodyTooLarge if the body is larger than 10 MB.
+func VerifyWebhook(r *http.Request, secret string) ([]byte, error) {
+	if secret == "" {
+		return nil, ErrNoClientSecret
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxWebhookBodySize))
+	r.Body.Close()
+	if err != nil && len(b) >= maxWebhookBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Shopify-Hmac-Sha256"))
+	if err != nil || len(sig) == 0 {
+		return nil, ErrInvalidHMAC
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(b)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidHMAC
+	}
+	return b, nil
+}
+
+// writeVerifyError writes 500 if the handler has no client secret, 413 if
+// the body is too large, or 401 if the request is not signed by Shopify.
+func writeVerifyError(w http.ResponseWriter, err error) {
+	status := http.StatusUnauthorized
+	switch err {
+	case ErrNoClientSecret:
+		status = http.StatusInternalServerError
+	case ErrBodyTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), status)
+}